@@ -2,19 +2,22 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
-	"github.com/gorilla/sessions"
-	"github.com/jackc/pgx/v5"
 	"github.com/redis/go-redis/v9"
 	"github.com/sumanthd032/go-shorty/internal/config"
+	"github.com/sumanthd032/go-shorty/internal/database"
 	"github.com/sumanthd032/go-shorty/internal/handlers"
 	"github.com/sumanthd032/go-shorty/internal/middleware"
 	"github.com/sumanthd032/go-shorty/internal/repositories/db"
@@ -22,62 +25,151 @@ import (
 )
 
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	conn, err := pgx.Connect(context.Background(), cfg.Database.DSN)
+	pool, err := database.NewPool(ctx, cfg.Database)
 	if err != nil {
 		log.Fatalf("Unable to connect to database: %v", err)
 	}
-	defer conn.Close(context.Background())
+	defer pool.Close()
 
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     cfg.Redis.Addr,
 		Password: cfg.Redis.Password,
 		DB:       cfg.Redis.DB,
 	})
-	if _, err := rdb.Ping(context.Background()).Result(); err != nil {
+	if _, err := rdb.Ping(ctx).Result(); err != nil {
 		log.Fatalf("Unable to connect to Redis: %v", err)
 	}
+	defer rdb.Close()
 
-	sessionStore := sessions.NewCookieStore([]byte(cfg.Auth.SessionKey))
-	queries := db.New(conn)
+	sessionStore := services.NewSessionStore(rdb, cfg.Auth, middleware.GetClientIP)
+	queries := db.New(pool)
 
-	linkService := services.NewLinkService(queries, rdb)
-	userService := services.NewUserService(queries)
+	clickPublisher, err := services.NewClickPublisher(rdb, cfg.ClickStream)
+	if err != nil {
+		log.Fatalf("Failed to set up click publisher: %v", err)
+	}
+	defer clickPublisher.Close()
+	go clickPublisher.Run(ctx)
 
-	linkHandler := handlers.NewLinkHandler(linkService, queries)
+	linkService := services.NewLinkService(queries, rdb, cfg.Links, clickPublisher)
+	mailer, err := services.NewMailer(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Failed to set up mailer: %v", err)
+	}
+	userService := services.NewUserService(queries, cfg.Privacy, sessionStore, services.NewLoginLimiter(rdb, cfg.Auth),
+		services.NewAccountTokens(queries, cfg.Auth), mailer, cfg.Mail.BaseURL)
+	visitorCounter := services.NewVisitorCounter(rdb, queries, cfg.Analytics.VisitorTTL)
+	// Every open live feed blocks a connection in XREAD, so the feeds get a
+	// pool of their own, sized for max_subscribers plus a few connections
+	// for subscribing and releasing.
+	liveRdb := redis.NewClient(&redis.Options{
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+		PoolSize: cfg.Live.MaxSubscribers + 10,
+	})
+	defer liveRdb.Close()
+	liveFeed := services.NewLiveFeed(liveRdb, cfg.Live)
+	tokenService := services.NewAPITokenService(queries)
+
+	expiredPage, err := handlers.ParseExpiredPage(cfg.Links.ExpiredPage)
+	if err != nil {
+		log.Fatalf("Failed to load expired link page: %v", err)
+	}
+
+	linkHandler := handlers.NewLinkHandler(linkService, queries, expiredPage)
 	userHandler := handlers.NewUserHandler(userService, sessionStore, queries)
-	analyticsHandler := handlers.NewAnalyticsHandler(queries)
+	analyticsHandler := handlers.NewAnalyticsHandler(queries, visitorCounter, cfg.Privacy.RetentionDays)
+	healthHandler := handlers.NewHealthHandler(pool, rdb, clickPublisher)
+	liveHandler := handlers.NewLiveHandler(queries, liveFeed)
+	exportHandler := handlers.NewExportHandler(pool, queries, services.NewExporter(queries), cfg.Export.Dir)
+	tokenHandler := handlers.NewTokenHandler(tokenService)
+	sessionHandler := handlers.NewSessionHandler(sessionStore)
 
-	authMiddleware := middleware.Auth(sessionStore)
+	authMiddleware := middleware.Auth(sessionStore, tokenService)
+
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Failed to parse trusted proxies: %v", err)
+	}
 
 	r := chi.NewRouter()
+	r.Use(middleware.ClientIP(trustedProxies))
 	r.Use(chiMiddleware.Logger)
 	r.Use(chiMiddleware.Recoverer)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:8080"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
+	r.Get("/healthz", healthHandler.GetHealth)
+
 	// --- API Routes ---
 	r.Route("/api", func(r chi.Router) {
 		r.Post("/users/register", userHandler.Register)
 		r.Post("/users/login", userHandler.Login)
+		r.Post("/users/verify", userHandler.VerifyEmail)
+		r.Post("/users/password/forgot", userHandler.ForgotPassword)
+		r.Post("/users/password/reset", userHandler.ResetPassword)
 
+		// Authenticated with the session cookie or a personal API token. API
+		// tokens only reach the routes their scopes allow.
 		r.Group(func(r chi.Router) {
 			r.Use(authMiddleware)
-			r.Post("/users/logout", userHandler.Logout)
-			r.Post("/links", linkHandler.CreateLink)
-			r.Get("/links", linkHandler.GetUserLinks)
 			r.Get("/users/me", userHandler.GetCurrentUser)
-			r.Get("/analytics", analyticsHandler.GetAnalytics)
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.SessionOnly)
+				r.Post("/users/logout", userHandler.Logout)
+				r.Get("/users/me/privacy", userHandler.GetPrivacy)
+				r.Put("/users/me/privacy", userHandler.UpdatePrivacy)
+				r.Post("/users/me/tokens", tokenHandler.CreateToken)
+				r.Get("/users/me/tokens", tokenHandler.ListTokens)
+				r.Delete("/users/me/tokens/{id}", tokenHandler.RevokeToken)
+				r.Get("/users/me/sessions", sessionHandler.ListSessions)
+				r.Delete("/users/me/sessions", sessionHandler.RevokeOtherSessions)
+				r.Delete("/users/me/sessions/{id}", sessionHandler.RevokeSession)
+				r.Put("/users/me/password", userHandler.ChangePassword)
+				r.Post("/users/verify/resend", userHandler.ResendVerification)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequireScope(services.ScopeLinksRead))
+				r.Get("/links", linkHandler.GetUserLinks)
+				r.Get("/links/{id}", linkHandler.GetLink)
+				r.Get("/links/{id}/live", liveHandler.StreamClicks)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequireScope(services.ScopeLinksWrite))
+				r.Post("/links", linkHandler.CreateLink)
+				r.Patch("/links/{id}", linkHandler.UpdateLink)
+				r.Delete("/links/{id}", linkHandler.DeleteLink)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequireScope(services.ScopeAnalyticsRead))
+				r.Get("/analytics", analyticsHandler.GetAnalytics)
+				r.Get("/analytics/links/{id}/timeseries", analyticsHandler.GetLinkTimeseries)
+				r.Get("/analytics/links/{id}/breakdown/{dimension}", analyticsHandler.GetLinkBreakdown)
+				r.Get("/analytics/export", exportHandler.Export)
+				r.Post("/analytics/exports", exportHandler.CreateExport)
+				r.Get("/analytics/exports", exportHandler.ListExports)
+				r.Get("/analytics/exports/{id}", exportHandler.GetExport)
+				r.Get("/analytics/exports/{id}/download", exportHandler.DownloadExport)
+			})
 		})
 	})
 
@@ -85,16 +177,52 @@ func main() {
 	// FIX: Added a regex to the alias to prevent it from matching files with extensions (like .html).
 	// It now only matches aliases containing letters, numbers, underscores, and hyphens.
 	r.Get("/{alias:[a-zA-Z0-9_-]+}", linkHandler.Redirect)
+	r.Post("/{alias:[a-zA-Z0-9_-]+}", linkHandler.Unlock)
 
 	// --- Static File Server for the UI ---
 	// This will now correctly handle requests for .html files because the route above no longer intercepts them.
 	workDir, _ := os.Getwd()
 	filesDir := http.Dir(filepath.Join(workDir, "static"))
+	// The auth middleware sends signed-out browsers here. Static routes take
+	// precedence over the alias route above.
+	r.Get("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join(workDir, "static", "login.html"))
+	})
 	r.Handle("/*", http.StripPrefix("/", http.FileServer(filesDir)))
 
 	port := fmt.Sprintf(":%d", cfg.Server.Port)
-	log.Printf("Server starting on port %s, serving UI from ./static/", port)
-	if err := http.ListenAndServe(port, r); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	srv := &http.Server{
+		Addr:              port,
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+		// No WriteTimeout: it would cut off the long-lived live click streams
+		// and streamed exports.
+	}
+	srv.RegisterOnShutdown(liveHandler.Close)
+
+	go func() {
+		log.Printf("Server starting on port %s, serving UI from ./static/", port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutdown signal received, draining connections...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server did not shut down cleanly: %v", err)
+	}
+	// Redirects served before shutdown may still be publishing their click events.
+	if err := linkService.Flush(shutdownCtx); err != nil {
+		log.Printf("Failed to flush click events: %v", err)
+	}
+	// Verification and password reset emails requested before shutdown.
+	if err := userService.Flush(shutdownCtx); err != nil {
+		log.Printf("Failed to flush account emails: %v", err)
 	}
+	log.Println("Server stopped")
 }
\ No newline at end of file
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	"github.com/sumanthd032/go-shorty/internal/repositories/db"
+	"github.com/sumanthd032/go-shorty/internal/services"
+	"github.com/sumanthd032/go-shorty/pkg/referrer"
+	"github.com/sumanthd032/go-shorty/pkg/useragent"
+)
+
+// clickEntry pairs a decoded click with the stream message it came from.
+type clickEntry struct {
+	message redis.XMessage
+	params  db.CreateClicksParams
+}
+
+// processBatch decodes the messages, writes the clicks and acknowledges every
+// message that was stored. Messages that cannot be decoded go straight to the
+// dead-letter stream since retrying them can never succeed.
+func (w *worker) processBatch(ctx context.Context, messages []redis.XMessage) {
+	decoded := make([]redis.XMessage, 0, len(messages))
+	events := make([]services.ClickEvent, 0, len(messages))
+	for _, message := range messages {
+		event, err := decodeClickEvent(message)
+		if err != nil {
+			w.deadLetter(ctx, message, err.Error())
+			continue
+		}
+		decoded = append(decoded, message)
+		events = append(events, event)
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	modes := w.ipModes(ctx, events)
+	entries := make([]clickEntry, 0, len(events))
+	for i, event := range events {
+		entries = append(entries, clickEntry{
+			message: decoded[i],
+			params:  w.clickParams(ctx, event, modes[event.LinkID]),
+		})
+	}
+	w.trackVisitors(ctx, events)
+	w.writeBatch(ctx, entries)
+}
+
+// trackVisitors counts the events of everything but bots towards unique
+// visitors. The fingerprint is taken from the address before it is anonymized
+// so the count is the same in every IP mode.
+func (w *worker) trackVisitors(ctx context.Context, events []services.ClickEvent) {
+	visits := make([]services.Visit, 0, len(events))
+	for _, event := range events {
+		if useragent.ParseHeader(event.UserAgent).Bot {
+			continue
+		}
+		at := event.Timestamp
+		if at.IsZero() {
+			at = time.Now()
+		}
+		visits = append(visits, services.Visit{
+			LinkID:      event.LinkID,
+			At:          at,
+			Fingerprint: services.VisitorFingerprint(event.IPAddress, event.UserAgent),
+		})
+	}
+	if err := w.visitors.Track(ctx, visits); err != nil {
+		log.Printf("Failed to track unique visitors: %v", err)
+	}
+}
+
+// ipModes returns the IP mode for the link of every event: the owner's
+// override if there is one, otherwise the deployment default. If the
+// overrides cannot be loaded, the hash mode is used so no owner gets less
+// privacy than they asked for.
+func (w *worker) ipModes(ctx context.Context, events []services.ClickEvent) map[int64]string {
+	modes := make(map[int64]string, len(events))
+	linkIDs := make([]int64, 0, len(events))
+	for _, event := range events {
+		if _, ok := modes[event.LinkID]; !ok {
+			modes[event.LinkID] = w.privacy.IPMode
+			linkIDs = append(linkIDs, event.LinkID)
+		}
+	}
+
+	overrides, err := w.queries.GetIPModesForLinks(ctx, linkIDs)
+	if err != nil {
+		log.Printf("Failed to load IP modes, hashing IPs of this batch: %v", err)
+		for linkID := range modes {
+			modes[linkID] = services.IPModeHash
+		}
+		return modes
+	}
+	for _, override := range overrides {
+		modes[override.LinkID] = override.IpMode.String
+	}
+	return modes
+}
+
+// clickParams turns an event into a row, parsing the user agent and referrer
+// and resolving the location once here so analytics queries only group by
+// plain columns. The IP is anonymized according to ipMode only after the
+// location has been looked up.
+func (w *worker) clickParams(ctx context.Context, event services.ClickEvent, ipMode string) db.CreateClicksParams {
+	ua := useragent.ParseHeader(event.UserAgent)
+	loc := w.geo.Lookup(event.IPAddress)
+
+	clickedAt := event.Timestamp
+	if clickedAt.IsZero() {
+		clickedAt = time.Now()
+	}
+	ip, err := w.anonymizer.Anonymize(ctx, event.IPAddress, ipMode, clickedAt)
+	if err != nil {
+		// Without a salt the address cannot be hashed; store none rather
+		// than the raw one.
+		log.Printf("Failed to anonymize IP of click on link %d: %v", event.LinkID, err)
+		ip = ""
+	}
+
+	userAgent := event.UserAgent
+	if !w.privacy.StoreUserAgent {
+		userAgent = ""
+	}
+
+	return db.CreateClicksParams{
+		LinkID:         event.LinkID,
+		ClickedAt:      pgtype.Timestamptz{Time: clickedAt, Valid: true},
+		IpAddress:      nullableText(ip),
+		UserAgent:      nullableText(userAgent),
+		Referrer:       pgtype.Text{String: event.Referrer, Valid: true},
+		Browser:        pgtype.Text{String: ua.Browser, Valid: true},
+		Os:             pgtype.Text{String: ua.OS, Valid: true},
+		DeviceType:     pgtype.Text{String: ua.Device, Valid: true},
+		ReferrerDomain: nullableText(referrer.Domain(event.Referrer)),
+		Country:        nullableText(loc.Country),
+		Region:         nullableText(loc.Region),
+		City:           nullableText(loc.City),
+		IsBot:          ua.Bot,
+		BotName:        nullableText(ua.BotName),
+		IsPreview:      ua.Preview,
+	}
+}
+
+// nullableText maps an empty string to NULL.
+func nullableText(s string) pgtype.Text {
+	return pgtype.Text{String: s, Valid: s != ""}
+}
+
+func decodeClickEvent(message redis.XMessage) (services.ClickEvent, error) {
+	var event services.ClickEvent
+	eventJSON, ok := message.Values["event"].(string)
+	if !ok {
+		return event, errors.New("invalid message format: 'event' field is not a string")
+	}
+	if err := json.Unmarshal([]byte(eventJSON), &event); err != nil {
+		return event, fmt.Errorf("failed to unmarshal event: %w", err)
+	}
+	return event, nil
+}
+
+// writeBatch stores entries, retrying transient failures with backoff. When the
+// batch is rejected because of its data, it is split in half and each half is
+// written on its own, so a single poison click cannot hold back the others.
+// Only data errors are split; a batch that still fails transiently after the
+// retries stays pending as a whole.
+func (w *worker) writeBatch(ctx context.Context, entries []clickEntry) {
+	err := w.insertClicks(ctx, entries)
+	for attempt := 1; err != nil && isTransient(err) && attempt <= w.cfg.BatchRetries; attempt++ {
+		log.Printf("Retrying batch of %d clicks (attempt %d): %v", len(entries), attempt, err)
+		time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
+		err = w.insertClicks(ctx, entries)
+	}
+
+	if err == nil {
+		ids := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			ids = append(ids, entry.message.ID)
+		}
+		w.ack(ctx, ids...)
+		w.publishLive(ctx, entries)
+		log.Printf("Processed batch of %d clicks", len(entries))
+		return
+	}
+
+	if isTransient(err) {
+		// Splitting cannot help while the database is unavailable. The batch
+		// is left unacknowledged for the reclaim loop to deliver again.
+		log.Printf("Failed to save batch of %d clicks: %v", len(entries), err)
+		return
+	}
+	if len(entries) == 1 {
+		w.deadLetter(ctx, entries[0].message, err.Error())
+		return
+	}
+
+	mid := len(entries) / 2
+	w.writeBatch(ctx, entries[:mid])
+	w.writeBatch(ctx, entries[mid:])
+}
+
+// publishLive pushes stored clicks to live subscribers. A failure only costs
+// the live view; the clicks themselves are already saved.
+func (w *worker) publishLive(ctx context.Context, entries []clickEntry) {
+	clicks := make([]services.LiveClick, 0, len(entries))
+	for _, entry := range entries {
+		p := entry.params
+		clicks = append(clicks, services.LiveClick{
+			LinkID:         p.LinkID,
+			ClickedAt:      p.ClickedAt.Time.UTC(),
+			Browser:        p.Browser.String,
+			OS:             p.Os.String,
+			Device:         p.DeviceType.String,
+			ReferrerDomain: p.ReferrerDomain.String,
+			Country:        p.Country.String,
+			Region:         p.Region.String,
+			City:           p.City.String,
+			IsBot:          p.IsBot,
+			BotName:        p.BotName.String,
+			IsPreview:      p.IsPreview,
+		})
+	}
+	if err := w.live.Publish(ctx, clicks); err != nil {
+		log.Printf("Failed to publish clicks to live feed: %v", err)
+	}
+}
+
+// insertClicks copies the clicks into Postgres and adds them to the rollups
+// inside a single transaction.
+func (w *worker) insertClicks(ctx context.Context, entries []clickEntry) error {
+	rows := make([]db.CreateClicksParams, 0, len(entries))
+	for _, entry := range entries {
+		rows = append(rows, entry.params)
+	}
+
+	tx, err := w.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := w.queries.WithTx(tx)
+	if err := qtx.LockRollupsShared(ctx); err != nil {
+		return fmt.Errorf("could not lock rollups: %w", err)
+	}
+	if _, err := qtx.CreateClicks(ctx, rows); err != nil {
+		return fmt.Errorf("could not copy clicks: %w", err)
+	}
+	if err := upsertRollups(ctx, qtx, rows); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (w *worker) ack(ctx context.Context, ids ...string) {
+	if err := w.rdb.XAck(ctx, w.stream, w.group, ids...).Err(); err != nil {
+		log.Printf("Failed to acknowledge %d messages: %v", len(ids), err)
+	}
+}
+
+// isTransient reports whether err is worth retrying as is. Data and integrity
+// errors (SQLSTATE classes 22 and 23) will fail again no matter how often the
+// same rows are sent.
+func isTransient(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		class := pgErr.Code[:2]
+		return class != "22" && class != "23"
+	}
+	return true
+}
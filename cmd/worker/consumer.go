@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// consume reads click events from the stream until ctx is cancelled. Messages
+// are collected until BatchSize is reached or BatchMaxWait has passed since the
+// first one arrived, then written in a single transaction. A batch that is
+// already collected when shutdown starts is still written and acknowledged.
+func (w *worker) consume(ctx context.Context, consumer string) {
+	batch := make([]redis.XMessage, 0, w.cfg.BatchSize)
+	var deadline time.Time
+
+	for ctx.Err() == nil {
+		block := w.cfg.ReadBlock
+		if len(batch) > 0 {
+			block = time.Until(deadline)
+			if block < time.Millisecond {
+				batch = w.flush(ctx, batch)
+				continue
+			}
+		}
+
+		streams, err := w.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    w.group,
+			Consumer: consumer,
+			Streams:  []string{w.stream, ">"},
+			Count:    int64(w.cfg.BatchSize - len(batch)),
+			Block:    block,
+		}).Result()
+
+		if err != nil {
+			if errors.Is(err, redis.Nil) || ctx.Err() != nil {
+				continue
+			}
+			log.Printf("Error reading from stream: %v", err)
+			sleepCtx(ctx, time.Second)
+			continue
+		}
+
+		for _, stream := range streams {
+			if len(batch) == 0 && len(stream.Messages) > 0 {
+				deadline = time.Now().Add(w.cfg.BatchMaxWait)
+			}
+			batch = append(batch, stream.Messages...)
+		}
+
+		if len(batch) >= w.cfg.BatchSize {
+			batch = w.flush(ctx, batch)
+		}
+	}
+
+	if len(batch) > 0 {
+		w.flush(ctx, batch)
+	}
+}
+
+// flush writes the batch and returns the emptied slice for reuse. It detaches
+// from the shutdown signal so a batch is never abandoned halfway.
+func (w *worker) flush(ctx context.Context, batch []redis.XMessage) []redis.XMessage {
+	w.processBatch(context.WithoutCancel(ctx), batch)
+	return batch[:0]
+}
+
+// sleepCtx pauses for d or until ctx is cancelled, whichever comes first.
+func sleepCtx(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
+
+// timeoutAfter is time.After that never fires for a non-positive duration.
+func timeoutAfter(d time.Duration) <-chan time.Time {
+	if d <= 0 {
+		return nil
+	}
+	return time.After(d)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+)
+
+// consumerPrefix returns the configured name, or hostname-pid so that replicas
+// never share a consumer identity and pending entries stay with their owner.
+func consumerPrefix(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "worker"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// consumerNames lists the names of the consumer goroutines of this process.
+func (w *worker) consumerNames() []string {
+	count := max(w.cfg.Consumers, 1)
+	names := make([]string, 0, count)
+	for i := 1; i <= count; i++ {
+		names = append(names, fmt.Sprintf("%s-%d", w.consumerPrefix, i))
+	}
+	return names
+}
+
+func (w *worker) reclaimConsumer() string {
+	return w.consumerPrefix + "-reclaim"
+}
+
+// cleanupConsumers deletes consumers of other processes that have nothing
+// pending and have been idle longer than ConsumerIdleTimeout. Consumers that
+// still own pending messages are left alone; reclaim takes their messages over
+// first, after which they are removed on a later pass.
+func (w *worker) cleanupConsumers(ctx context.Context) {
+	if w.cfg.ConsumerIdleTimeout <= 0 {
+		return
+	}
+
+	consumers, err := w.rdb.XInfoConsumers(ctx, w.stream, w.group).Result()
+	if err != nil {
+		log.Printf("Failed to list consumers: %v", err)
+		return
+	}
+
+	own := append(w.consumerNames(), w.reclaimConsumer())
+	for _, consumer := range consumers {
+		if slices.Contains(own, consumer.Name) || consumer.Pending > 0 || consumer.Idle < w.cfg.ConsumerIdleTimeout {
+			continue
+		}
+		if err := w.rdb.XGroupDelConsumer(ctx, w.stream, w.group, consumer.Name).Err(); err != nil {
+			log.Printf("Failed to remove idle consumer %s: %v", consumer.Name, err)
+			continue
+		}
+		log.Printf("Removed idle consumer %s (idle for %s)", consumer.Name, consumer.Idle)
+	}
+}
+
+// removeConsumers deletes this process's consumers on a clean shutdown. A
+// consumer that still owns pending messages is kept so they can be reclaimed.
+func (w *worker) removeConsumers(ctx context.Context, names []string) {
+	consumers, err := w.rdb.XInfoConsumers(ctx, w.stream, w.group).Result()
+	if err != nil {
+		log.Printf("Failed to list consumers: %v", err)
+		return
+	}
+
+	names = append(names, w.reclaimConsumer())
+	for _, consumer := range consumers {
+		if !slices.Contains(names, consumer.Name) || consumer.Pending > 0 {
+			continue
+		}
+		if err := w.rdb.XGroupDelConsumer(ctx, w.stream, w.group, consumer.Name).Err(); err != nil {
+			log.Printf("Failed to remove consumer %s: %v", consumer.Name, err)
+		}
+	}
+}
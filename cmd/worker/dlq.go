@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const dlqUsage = `usage:
+  worker dlq list [-n count]            show the oldest dead-lettered messages
+  worker dlq replay [-n count] [id ...] move messages back onto the click stream`
+
+// runCommand dispatches the admin subcommands of the worker binary.
+func runCommand(ctx context.Context, w *worker, args []string) error {
+	switch args[0] {
+	case "dlq":
+		return w.runDLQ(ctx, args[1:])
+	case "rollups":
+		return w.runRollups(ctx, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q\n%s\n%s", args[0], dlqUsage, rollupsUsage)
+	}
+}
+
+func (w *worker) runDLQ(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New(dlqUsage)
+	}
+
+	fs := flag.NewFlagSet("dlq "+args[0], flag.ContinueOnError)
+	count := fs.Int64("n", 20, "maximum number of messages")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		return w.listDeadLetters(ctx, *count)
+	case "replay":
+		return w.replayDeadLetters(ctx, *count, fs.Args())
+	default:
+		return fmt.Errorf("unknown dlq command %q\n%s", args[0], dlqUsage)
+	}
+}
+
+func (w *worker) listDeadLetters(ctx context.Context, count int64) error {
+	total, err := w.rdb.XLen(ctx, w.deadLetterStream).Result()
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", w.deadLetterStream, err)
+	}
+	messages, err := w.rdb.XRangeN(ctx, w.deadLetterStream, "-", "+", count).Result()
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", w.deadLetterStream, err)
+	}
+
+	fmt.Printf("%d messages in %s\n\n", total, w.deadLetterStream)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tORIGINAL ID\tDEAD AT\tREASON\tEVENT")
+	for _, message := range messages {
+		fmt.Fprintf(tw, "%s\t%v\t%v\t%v\t%v\n",
+			message.ID,
+			message.Values["dead_original_id"],
+			message.Values["dead_at"],
+			message.Values["dead_reason"],
+			message.Values["event"],
+		)
+	}
+	return tw.Flush()
+}
+
+// replayDeadLetters re-publishes dead-lettered events onto the main stream and
+// removes them from the dead-letter stream. With no ids the oldest count
+// messages are replayed.
+func (w *worker) replayDeadLetters(ctx context.Context, count int64, ids []string) error {
+	var messages []redis.XMessage
+	if len(ids) == 0 {
+		var err error
+		messages, err = w.rdb.XRangeN(ctx, w.deadLetterStream, "-", "+", count).Result()
+		if err != nil {
+			return fmt.Errorf("could not read %s: %w", w.deadLetterStream, err)
+		}
+	} else {
+		for _, id := range ids {
+			found, err := w.rdb.XRangeN(ctx, w.deadLetterStream, id, id, 1).Result()
+			if err != nil {
+				return fmt.Errorf("could not read %s: %w", w.deadLetterStream, err)
+			}
+			if len(found) == 0 {
+				return fmt.Errorf("message %s not found in %s", id, w.deadLetterStream)
+			}
+			messages = append(messages, found[0])
+		}
+	}
+
+	for _, message := range messages {
+		newID, err := w.rdb.XAdd(ctx, &redis.XAddArgs{
+			Stream: w.stream,
+			Values: map[string]interface{}{"event": message.Values["event"]},
+		}).Result()
+		if err != nil {
+			return fmt.Errorf("could not replay %s: %w", message.ID, err)
+		}
+		if err := w.rdb.XDel(ctx, w.deadLetterStream, message.ID).Err(); err != nil {
+			return fmt.Errorf("replayed %s as %s but could not remove it: %w", message.ID, newID, err)
+		}
+		fmt.Printf("Replayed %s as %s\n", message.ID, newID)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/sumanthd032/go-shorty/internal/services"
+)
+
+// runExpiryJob periodically marks links whose expires_at has passed and evicts
+// them from the redirect cache. It returns when ctx is cancelled.
+func (w *worker) runExpiryJob(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.ExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		w.expireLinks(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *worker) expireLinks(ctx context.Context) {
+	aliases, err := w.queries.MarkExpiredLinks(ctx)
+	if err != nil {
+		log.Printf("Failed to mark expired links: %v", err)
+		return
+	}
+	if len(aliases) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		keys = append(keys, services.LinkCacheKey(alias))
+	}
+	if err := w.rdb.Del(ctx, keys...).Err(); err != nil {
+		log.Printf("Failed to evict expired links from cache: %v", err)
+	}
+
+	log.Printf("Marked %d links as expired", len(aliases))
+}
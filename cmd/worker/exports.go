@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sumanthd032/go-shorty/internal/repositories/db"
+	"github.com/sumanthd032/go-shorty/internal/services"
+)
+
+// runExportJob periodically runs queued analytics exports, one at a time, and
+// deletes expired ones. It returns when ctx is cancelled.
+func (w *worker) runExportJob(ctx context.Context) {
+	if err := os.MkdirAll(w.export.Dir, 0o750); err != nil {
+		log.Printf("Not running exports, cannot create %s: %v", w.export.Dir, err)
+		return
+	}
+
+	ticker := time.NewTicker(w.export.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		w.deleteExpiredExports(ctx)
+		for ctx.Err() == nil && w.runNextExport(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNextExport claims and runs one export job. It reports whether there was
+// a job to run.
+func (w *worker) runNextExport(ctx context.Context) bool {
+	job, err := w.queries.ClaimExportJob(ctx, pgtype.Timestamptz{Time: time.Now().Add(-w.export.StaleAfter), Valid: true})
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("Failed to claim export job: %v", err)
+		}
+		return false
+	}
+
+	req := services.ExportRequest{
+		UserID:  job.UserID,
+		Dataset: job.Dataset,
+		Format:  job.Format,
+		LinkID:  job.LinkID.Int64,
+		From:    job.FromTime.Time,
+		To:      job.ToTime.Time,
+	}
+	fileName := fmt.Sprintf("export-%d.%s", job.ID, job.Format)
+	rows, err := w.writeExport(ctx, req, fileName)
+	interrupted := ctx.Err() != nil
+
+	// The job's outcome is recorded even when shutdown interrupted it.
+	ctx = context.WithoutCancel(ctx)
+	expiresAt := pgtype.Timestamptz{Time: time.Now().Add(w.export.FileTTL), Valid: true}
+	switch {
+	case err == nil:
+		err = w.queries.CompleteExportJob(ctx, db.CompleteExportJobParams{
+			ID:        job.ID,
+			FileName:  pgtype.Text{String: fileName, Valid: true},
+			RowCount:  rows,
+			ExpiresAt: expiresAt,
+		})
+		if err == nil {
+			log.Printf("Exported %d rows for job %d", rows, job.ID)
+		}
+	case interrupted:
+		log.Printf("Export job %d interrupted by shutdown, requeueing it", job.ID)
+		err = w.queries.ReleaseExportJob(ctx, job.ID)
+	default:
+		log.Printf("Export job %d failed: %v", job.ID, err)
+		err = w.queries.FailExportJob(ctx, db.FailExportJobParams{
+			ID:        job.ID,
+			Error:     pgtype.Text{String: "Export failed", Valid: true},
+			ExpiresAt: expiresAt,
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to update export job %d: %v", job.ID, err)
+	}
+	return true
+}
+
+// writeExport writes the export to a temporary file and renames it into place
+// once complete, so the server never serves a partial file.
+func (w *worker) writeExport(ctx context.Context, req services.ExportRequest, fileName string) (int64, error) {
+	f, err := os.CreateTemp(w.export.Dir, fileName+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("could not create export file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	rows, err := w.exporter.Write(ctx, f, req)
+	if err != nil {
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, fmt.Errorf("could not write export file: %w", err)
+	}
+	if err := os.Rename(f.Name(), filepath.Join(w.export.Dir, fileName)); err != nil {
+		return 0, fmt.Errorf("could not move export file into place: %w", err)
+	}
+	return rows, nil
+}
+
+func (w *worker) deleteExpiredExports(ctx context.Context) {
+	fileNames, err := w.queries.DeleteExpiredExportJobs(ctx)
+	if err != nil {
+		log.Printf("Failed to delete expired exports: %v", err)
+		return
+	}
+	for _, fileName := range fileNames {
+		if !fileName.Valid {
+			continue
+		}
+		path := filepath.Join(w.export.Dir, filepath.Base(fileName.String))
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to delete export file %s: %v", path, err)
+		}
+	}
+	if len(fileNames) > 0 {
+		log.Printf("Deleted %d expired exports", len(fileNames))
+	}
+}
@@ -2,32 +2,54 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 	"github.com/sumanthd032/go-shorty/internal/config"
+	"github.com/sumanthd032/go-shorty/internal/database"
 	"github.com/sumanthd032/go-shorty/internal/repositories/db"
-	"github.com/sumanthd032/go-shorty/internal/services" // <-- FIX: Corrected the import path
+	"github.com/sumanthd032/go-shorty/internal/services"
+	"github.com/sumanthd032/go-shorty/pkg/geoip"
 )
 
+// worker holds the dependencies shared by the stream consumer and the
+// periodic jobs.
+type worker struct {
+	pool             *pgxpool.Pool
+	queries          *db.Queries
+	rdb              *redis.Client
+	cfg              config.WorkerConfig
+	stream           string
+	group            string
+	deadLetterStream string
+	// consumerPrefix identifies this process within the consumer group.
+	consumerPrefix string
+	geo            *geoip.Reader
+	privacy        config.PrivacyConfig
+	anonymizer     *services.IPAnonymizer
+	visitors       *services.VisitorCounter
+	analytics      config.AnalyticsConfig
+	live           *services.LiveFeed
+	export         config.ExportConfig
+	exporter       *services.Exporter
+	// database is only used by admin commands that connect on their own.
+	database config.DatabaseConfig
+}
+
 func main() {
-	log.Println("Starting click processing worker...")
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	conn, err := pgx.Connect(ctx, cfg.Database.DSN)
-	if err != nil {
-		log.Fatalf("Unable to connect to database: %v", err)
-	}
-	defer conn.Close(ctx)
-
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     cfg.Redis.Addr,
 		Password: cfg.Redis.Password,
@@ -36,61 +58,117 @@ func main() {
 	if _, err := rdb.Ping(ctx).Result(); err != nil {
 		log.Fatalf("Unable to connect to Redis: %v", err)
 	}
+	defer rdb.Close()
+
+	w := &worker{
+		rdb:              rdb,
+		cfg:              cfg.Worker,
+		stream:           cfg.ClickStream.Name,
+		group:            cfg.ClickStream.Group,
+		deadLetterStream: cfg.ClickStream.DeadLetter,
+		consumerPrefix:   consumerPrefix(cfg.Worker.ConsumerName),
+		privacy:          cfg.Privacy,
+		anonymizer:       services.NewIPAnonymizer(rdb),
+		analytics:        cfg.Analytics,
+		live:             services.NewLiveFeed(rdb, cfg.Live),
+		export:           cfg.Export,
+		database:         cfg.Database,
+	}
+
+	// Admin commands such as "worker dlq list" run once and exit.
+	if len(os.Args) > 1 {
+		if err := runCommand(ctx, w, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	log.Println("Starting click processing worker...")
+
+	if !services.ValidIPMode(cfg.Privacy.IPMode) {
+		log.Fatalf("Invalid privacy.ip_mode %q: %v", cfg.Privacy.IPMode, services.ErrInvalidIPMode)
+	}
 
-	queries := db.New(conn)
-	streamName := "clicks_stream"
-	groupName := "clicks_group"
+	pool, err := database.NewPool(ctx, cfg.Database)
+	if err != nil {
+		log.Fatalf("Unable to connect to database: %v", err)
+	}
+	defer pool.Close()
+
+	w.pool = pool
+	w.queries = db.New(pool)
+	w.visitors = services.NewVisitorCounter(rdb, w.queries, cfg.Analytics.VisitorTTL)
+	w.exporter = services.NewExporter(w.queries)
+
+	geo, err := geoip.Open(cfg.Worker.GeoIPPath)
+	if err != nil {
+		log.Fatalf("Unable to load GeoIP database: %v", err)
+	}
+	defer geo.Close()
+	if !geo.Enabled() {
+		log.Println("No GeoIP database configured, clicks will be stored without location")
+	}
+	w.geo = geo
 
-	err = rdb.XGroupCreateMkStream(ctx, streamName, groupName, "0").Err()
+	err = rdb.XGroupCreateMkStream(ctx, w.stream, w.group, "0").Err()
 	if err != nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
 		log.Printf("Error creating consumer group: %v", err)
 	}
 
-	log.Printf("Worker is listening for messages on stream '%s' in group '%s'", streamName, groupName)
-
-	for {
-		// FIX: Corrected the struct name from XRead-groupArgs to XReadGroupArgs
-		streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
-			Group:    groupName,
-			Consumer: "consumer-1",
-			Streams:  []string{streamName, ">"},
-			Count:    1,
-			Block:    0,
-		}).Result()
-
-		if err != nil {
-			log.Printf("Error reading from stream: %v", err)
-			continue
+	go func() {
+		if err := geo.Watch(ctx); err != nil {
+			log.Printf("Not watching GeoIP database for changes: %v", err)
 		}
+	}()
 
-		for _, stream := range streams {
-			for _, message := range stream.Messages {
-				eventJSON, ok := message.Values["event"].(string)
-				if !ok {
-					log.Println("Invalid message format: 'event' field is not a string")
-					continue
-				}
-
-				var event services.ClickEvent
-				if err := json.Unmarshal([]byte(eventJSON), &event); err != nil {
-					log.Printf("Failed to unmarshal event: %v", err)
-					continue
-				}
-
-				_, err := queries.CreateClick(ctx, db.CreateClickParams{
-					LinkID:    event.LinkID,
-					IpAddress: pgtype.Text{String: event.IPAddress, Valid: true},
-					UserAgent: pgtype.Text{String: event.UserAgent, Valid: true},
-					Referrer:  pgtype.Text{String: event.Referrer, Valid: true},
-				})
-
-				if err != nil {
-					log.Printf("Failed to save click to database: %v", err)
-				} else {
-					log.Printf("Processed click for LinkID %d", event.LinkID)
-					rdb.XAck(ctx, streamName, groupName, message.ID)
-				}
-			}
-		}
+	var wg sync.WaitGroup
+	wg.Add(5)
+	go func() {
+		defer wg.Done()
+		w.runExpiryJob(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		w.runRetentionJob(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		w.runVisitorPersistJob(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		w.runReclaimLoop(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		w.runExportJob(ctx)
+	}()
+
+	consumers := w.consumerNames()
+	for _, name := range consumers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.consume(ctx, name)
+		}()
+	}
+
+	log.Printf("Worker is listening for messages on stream '%s' in group '%s' as %v", w.stream, w.group, consumers)
+	<-ctx.Done()
+	log.Println("Shutdown signal received, finishing in-flight work...")
+
+	// Give the consumer a bounded amount of time to finish its current batch.
+	// Whatever it could not ack stays in the pending entries list.
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		w.removeConsumers(context.WithoutCancel(ctx), consumers)
+		log.Println("Worker stopped cleanly")
+	case <-timeoutAfter(cfg.Worker.ShutdownTimeout):
+		log.Println("Shutdown timeout reached, unacknowledged messages will be redelivered")
 	}
-}
\ No newline at end of file
+}
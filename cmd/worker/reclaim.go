@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// runReclaimLoop periodically takes over messages that have sat unacknowledged
+// in the group's pending entries list for longer than ReclaimIdle, typically
+// because a consumer died between XREADGROUP and XACK, and then removes dead
+// consumers from the group. It returns when ctx is cancelled.
+func (w *worker) runReclaimLoop(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.ReclaimInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		w.reclaim(ctx)
+		w.cleanupConsumers(ctx)
+	}
+}
+
+// reclaim walks the whole pending entries list once. Claimed messages that have
+// been delivered more than MaxDeliveries times are moved to the dead-letter
+// stream; the rest are processed again.
+func (w *worker) reclaim(ctx context.Context) {
+	start := "0-0"
+	for ctx.Err() == nil {
+		messages, next, err := w.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   w.stream,
+			Group:    w.group,
+			Consumer: w.reclaimConsumer(),
+			MinIdle:  w.cfg.ReclaimIdle,
+			Start:    start,
+			Count:    int64(w.cfg.BatchSize),
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to reclaim pending messages: %v", err)
+			}
+			return
+		}
+
+		if len(messages) > 0 {
+			counts := w.deliveryCounts(ctx, messages)
+			retry := make([]redis.XMessage, 0, len(messages))
+			for _, message := range messages {
+				if counts[message.ID] > int64(w.cfg.MaxDeliveries) {
+					w.deadLetter(ctx, message, "exceeded max deliveries ("+strconv.FormatInt(counts[message.ID], 10)+")")
+					continue
+				}
+				retry = append(retry, message)
+			}
+			if len(retry) > 0 {
+				log.Printf("Reclaimed %d pending messages", len(retry))
+				w.processBatch(context.WithoutCancel(ctx), retry)
+			}
+		}
+
+		if next == "0-0" || next == "" {
+			return
+		}
+		start = next
+	}
+}
+
+// deliveryCounts looks up how often each message has been delivered.
+func (w *worker) deliveryCounts(ctx context.Context, messages []redis.XMessage) map[string]int64 {
+	cmds := make([]*redis.XPendingExtCmd, 0, len(messages))
+	_, err := w.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, message := range messages {
+			cmds = append(cmds, pipe.XPendingExt(ctx, &redis.XPendingExtArgs{
+				Stream: w.stream,
+				Group:  w.group,
+				Start:  message.ID,
+				End:    message.ID,
+				Count:  1,
+			}))
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to read delivery counts: %v", err)
+	}
+
+	counts := make(map[string]int64, len(messages))
+	for _, cmd := range cmds {
+		pending, err := cmd.Result()
+		if err != nil || len(pending) == 0 {
+			continue
+		}
+		counts[pending[0].ID] = pending[0].RetryCount
+	}
+	return counts
+}
+
+// deadLetter copies message to the dead-letter stream with the reason it was
+// given up on, then acknowledges it on the main stream.
+func (w *worker) deadLetter(ctx context.Context, message redis.XMessage, reason string) {
+	values := make(map[string]interface{}, len(message.Values)+3)
+	for k, v := range message.Values {
+		values[k] = v
+	}
+	values["dead_reason"] = reason
+	values["dead_original_id"] = message.ID
+	values["dead_at"] = time.Now().UTC().Format(time.RFC3339)
+
+	if err := w.rdb.XAdd(ctx, &redis.XAddArgs{Stream: w.deadLetterStream, Values: values}).Err(); err != nil {
+		// Keep it pending so the next reclaim pass can try again.
+		log.Printf("Failed to dead-letter message %s: %v", message.ID, err)
+		return
+	}
+	w.ack(ctx, message.ID)
+	log.Printf("Moved message %s to %s: %s", message.ID, w.deadLetterStream, reason)
+}
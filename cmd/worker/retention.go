@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sumanthd032/go-shorty/internal/repositories/db"
+)
+
+// runRetentionJob periodically deletes raw clicks older than the retention
+// period. Their counts live on in the click rollups. It does nothing when no
+// retention period is configured and returns when ctx is cancelled.
+func (w *worker) runRetentionJob(ctx context.Context) {
+	if w.privacy.RetentionDays <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(w.privacy.RetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		w.purgeClicks(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeClicks works in batches so a large backlog does not hold one long
+// transaction and its locks.
+func (w *worker) purgeClicks(ctx context.Context) {
+	before := time.Now().AddDate(0, 0, -w.privacy.RetentionDays)
+
+	var total int64
+	for ctx.Err() == nil {
+		purged, err := w.queries.PurgeClicks(ctx, db.PurgeClicksParams{
+			Before:    pgtype.Timestamptz{Time: before, Valid: true},
+			BatchSize: w.privacy.RetentionBatchSize,
+		})
+		if err != nil {
+			log.Printf("Failed to delete clicks older than %d days: %v", w.privacy.RetentionDays, err)
+			break
+		}
+		total += purged
+		if purged < int64(w.privacy.RetentionBatchSize) {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Printf("Deleted %d clicks older than %d days", total, w.privacy.RetentionDays)
+	}
+}
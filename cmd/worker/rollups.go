@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sumanthd032/go-shorty/internal/database"
+	"github.com/sumanthd032/go-shorty/internal/repositories/db"
+)
+
+const rollupsUsage = `usage:
+  worker rollups backfill [-from YYYY-MM-DD] [-to YYYY-MM-DD]
+                                        rebuild click rollups from raw clicks`
+
+// rollupKey identifies one rollup row. bucket is the UTC hour or day.
+type rollupKey struct {
+	linkID         int64
+	bucket         time.Time
+	country        string
+	deviceType     string
+	referrerDomain string
+	isBot          bool
+}
+
+type rollupCounts struct {
+	clicks   int64
+	previews int64
+}
+
+// upsertRollups adds the clicks to the hourly and daily rollups. It must run
+// in the transaction that stores the clicks so both are committed together.
+func upsertRollups(ctx context.Context, queries *db.Queries, rows []db.CreateClicksParams) error {
+	hourly := aggregateRollups(rows, func(t time.Time) time.Time { return t.Truncate(time.Hour) })
+	daily := aggregateRollups(rows, utcDay)
+
+	hourlyParams := db.UpsertHourlyRollupsParams{}
+	for _, key := range sortedRollupKeys(hourly) {
+		counts := hourly[key]
+		hourlyParams.LinkIds = append(hourlyParams.LinkIds, key.linkID)
+		hourlyParams.Buckets = append(hourlyParams.Buckets, pgtype.Timestamptz{Time: key.bucket, Valid: true})
+		hourlyParams.Countries = append(hourlyParams.Countries, key.country)
+		hourlyParams.DeviceTypes = append(hourlyParams.DeviceTypes, key.deviceType)
+		hourlyParams.ReferrerDomains = append(hourlyParams.ReferrerDomains, key.referrerDomain)
+		hourlyParams.IsBots = append(hourlyParams.IsBots, key.isBot)
+		hourlyParams.Clicks = append(hourlyParams.Clicks, counts.clicks)
+		hourlyParams.Previews = append(hourlyParams.Previews, counts.previews)
+	}
+	if err := queries.UpsertHourlyRollups(ctx, hourlyParams); err != nil {
+		return fmt.Errorf("could not update hourly rollups: %w", err)
+	}
+
+	dailyParams := db.UpsertDailyRollupsParams{}
+	for _, key := range sortedRollupKeys(daily) {
+		counts := daily[key]
+		dailyParams.LinkIds = append(dailyParams.LinkIds, key.linkID)
+		dailyParams.Days = append(dailyParams.Days, pgtype.Date{Time: key.bucket, Valid: true})
+		dailyParams.Countries = append(dailyParams.Countries, key.country)
+		dailyParams.DeviceTypes = append(dailyParams.DeviceTypes, key.deviceType)
+		dailyParams.ReferrerDomains = append(dailyParams.ReferrerDomains, key.referrerDomain)
+		dailyParams.IsBots = append(dailyParams.IsBots, key.isBot)
+		dailyParams.Clicks = append(dailyParams.Clicks, counts.clicks)
+		dailyParams.Previews = append(dailyParams.Previews, counts.previews)
+	}
+	if err := queries.UpsertDailyRollups(ctx, dailyParams); err != nil {
+		return fmt.Errorf("could not update daily rollups: %w", err)
+	}
+	return nil
+}
+
+// aggregateRollups counts the clicks per rollup key, with bucket mapping each
+// click's UTC time to the start of its bucket.
+func aggregateRollups(rows []db.CreateClicksParams, bucket func(time.Time) time.Time) map[rollupKey]rollupCounts {
+	counts := make(map[rollupKey]rollupCounts)
+	for _, row := range rows {
+		key := rollupKey{
+			linkID:         row.LinkID,
+			bucket:         bucket(row.ClickedAt.Time.UTC()),
+			country:        row.Country.String,
+			deviceType:     row.DeviceType.String,
+			referrerDomain: row.ReferrerDomain.String,
+			isBot:          row.IsBot,
+		}
+		c := counts[key]
+		c.clicks++
+		if row.IsPreview {
+			c.previews++
+		}
+		counts[key] = c
+	}
+	return counts
+}
+
+// sortedRollupKeys orders keys like the rollup primary keys, so concurrent
+// batches lock shared rows in the same order and cannot deadlock each other.
+func sortedRollupKeys(counts map[rollupKey]rollupCounts) []rollupKey {
+	keys := make([]rollupKey, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch {
+		case a.linkID != b.linkID:
+			return a.linkID < b.linkID
+		case !a.bucket.Equal(b.bucket):
+			return a.bucket.Before(b.bucket)
+		case a.country != b.country:
+			return a.country < b.country
+		case a.deviceType != b.deviceType:
+			return a.deviceType < b.deviceType
+		case a.referrerDomain != b.referrerDomain:
+			return a.referrerDomain < b.referrerDomain
+		default:
+			return !a.isBot && b.isBot
+		}
+	})
+	return keys
+}
+
+func (w *worker) runRollups(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "backfill" {
+		return errors.New(rollupsUsage)
+	}
+
+	fs := flag.NewFlagSet("rollups backfill", flag.ContinueOnError)
+	fromValue := fs.String("from", "", "first UTC day to rebuild (default: oldest complete day of raw clicks)")
+	toValue := fs.String("to", "", "last UTC day to rebuild (default: today)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	pool, err := database.NewPool(ctx, w.database)
+	if err != nil {
+		return fmt.Errorf("unable to connect to database: %w", err)
+	}
+	defer pool.Close()
+	w.pool = pool
+	w.queries = db.New(pool)
+
+	// Rollups of days before this one may hold clicks whose raw rows are
+	// gone, deleted by the retention job or archived before rollups existed,
+	// so they must not be rebuilt.
+	oldest, err := w.queries.GetOldestClickTime(ctx)
+	if err != nil {
+		return fmt.Errorf("could not find the oldest click: %w", err)
+	}
+	if !oldest.Valid {
+		fmt.Println("No raw clicks to build rollups from")
+		return nil
+	}
+	firstDay := utcDay(oldest.Time)
+	if w.privacy.RetentionDays > 0 {
+		firstDay = firstDay.AddDate(0, 0, 1)
+	}
+
+	from := firstDay
+	if *fromValue != "" {
+		if from, err = time.Parse(time.DateOnly, *fromValue); err != nil {
+			return errors.New("-from must be a YYYY-MM-DD date")
+		}
+		if from.Before(firstDay) {
+			return fmt.Errorf("raw clicks before %s may be incomplete; rebuilding those days would lose counts", firstDay.Format(time.DateOnly))
+		}
+	}
+	to := utcDay(time.Now())
+	if *toValue != "" {
+		if to, err = time.Parse(time.DateOnly, *toValue); err != nil {
+			return errors.New("-to must be a YYYY-MM-DD date")
+		}
+	}
+	if to.Before(from) {
+		return errors.New("-from must not be after -to")
+	}
+
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		rebuilt, err := w.rebuildRollups(ctx, day)
+		if err != nil {
+			return fmt.Errorf("could not rebuild rollups for %s: %w", day.Format(time.DateOnly), err)
+		}
+		fmt.Printf("Rebuilt %s: %d hourly rows\n", day.Format(time.DateOnly), rebuilt)
+	}
+	return nil
+}
+
+// rebuildRollups replaces the rollups of one UTC day with counts from the raw
+// clicks. The exclusive lock waits for in-flight click batches and holds new
+// ones back until the day is rebuilt, so none are counted twice or missed.
+func (w *worker) rebuildRollups(ctx context.Context, day time.Time) (int64, error) {
+	fromTime := pgtype.Timestamptz{Time: day, Valid: true}
+	toTime := pgtype.Timestamptz{Time: day.AddDate(0, 0, 1), Valid: true}
+
+	tx, err := w.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	qtx := w.queries.WithTx(tx)
+
+	if err := qtx.LockRollups(ctx); err != nil {
+		return 0, err
+	}
+	if err := qtx.DeleteHourlyRollups(ctx, db.DeleteHourlyRollupsParams{FromTime: fromTime, ToTime: toTime}); err != nil {
+		return 0, err
+	}
+	if err := qtx.DeleteDailyRollups(ctx, db.DeleteDailyRollupsParams{
+		FromDay: pgtype.Date{Time: day, Valid: true},
+		ToDay:   pgtype.Date{Time: day.AddDate(0, 0, 1), Valid: true},
+	}); err != nil {
+		return 0, err
+	}
+	rebuilt, err := qtx.RebuildHourlyRollups(ctx, db.RebuildHourlyRollupsParams{FromTime: fromTime, ToTime: toTime})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := qtx.RebuildDailyRollups(ctx, db.RebuildDailyRollupsParams{FromTime: fromTime, ToTime: toTime}); err != nil {
+		return 0, err
+	}
+	return rebuilt, tx.Commit(ctx)
+}
+
+// utcDay returns midnight UTC of the day t falls on in UTC.
+func utcDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// runVisitorPersistJob periodically copies changed unique-visitor
+// HyperLogLogs to Postgres, and once more on shutdown.
+func (w *worker) runVisitorPersistJob(ctx context.Context) {
+	ticker := time.NewTicker(w.analytics.VisitorPersistInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.persistVisitors(context.WithoutCancel(ctx))
+			return
+		case <-ticker.C:
+			w.persistVisitors(ctx)
+		}
+	}
+}
+
+func (w *worker) persistVisitors(ctx context.Context) {
+	saved, err := w.visitors.Persist(ctx)
+	if err != nil {
+		log.Printf("Failed to persist unique visitors: %v", err)
+	}
+	if saved > 0 {
+		log.Printf("Persisted %d unique visitor sketches", saved)
+	}
+}
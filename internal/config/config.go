@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/spf13/viper"
 )
 
@@ -9,14 +11,34 @@ type Config struct {
 	Database DatabaseConfig
 	Redis    RedisConfig 
 	Auth     AuthConfig
+	Links    LinksConfig
+	Worker   WorkerConfig
+	// ClickStream names the Redis stream shared by the server and the worker.
+	ClickStream ClickStreamConfig `mapstructure:"click_stream"`
+	Privacy     PrivacyConfig
+	Analytics   AnalyticsConfig
+	Live        LiveConfig
+	Export      ExportConfig
+	Mail        MailConfig
 }
 
 type ServerConfig struct {
 	Port int `mapstructure:"port"`
+	// ShutdownTimeout bounds how long in-flight requests and click events are drained on SIGINT/SIGTERM.
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// TrustedProxies lists the CIDRs of proxies whose Forwarded, X-Forwarded-For
+	// and X-Real-IP headers are believed. Empty means the headers are ignored.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 type DatabaseConfig struct {
 	DSN string `mapstructure:"dsn"`
+	// Pool settings. Zero values keep the pgxpool defaults.
+	MaxConns          int32         `mapstructure:"max_conns"`
+	MinConns          int32         `mapstructure:"min_conns"`
+	MaxConnLifetime   time.Duration `mapstructure:"max_conn_lifetime"`
+	MaxConnIdleTime   time.Duration `mapstructure:"max_conn_idle_time"`
+	HealthCheckPeriod time.Duration `mapstructure:"health_check_period"`
 }
 
 func LoadConfig() (config Config, err error) {
@@ -24,6 +46,62 @@ func LoadConfig() (config Config, err error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
 
+	viper.SetDefault("server.shutdown_timeout", 15*time.Second)
+	viper.SetDefault("auth.session_idle_timeout", 7*24*time.Hour)
+	viper.SetDefault("auth.session_max_age", 30*24*time.Hour)
+	viper.SetDefault("auth.login_window", 15*time.Minute)
+	viper.SetDefault("auth.login_ip_limit", 30)
+	viper.SetDefault("auth.login_delay_after", 3)
+	viper.SetDefault("auth.login_delay", time.Second)
+	viper.SetDefault("auth.login_max_delay", 8*time.Second)
+	viper.SetDefault("auth.login_lockout_after", 10)
+	viper.SetDefault("auth.login_lockout", 15*time.Minute)
+	viper.SetDefault("auth.register_ip_limit", 5)
+	viper.SetDefault("auth.register_window", time.Hour)
+	viper.SetDefault("auth.account_email_ip_limit", 5)
+	viper.SetDefault("auth.verify_token_ttl", 48*time.Hour)
+	viper.SetDefault("auth.reset_token_ttl", time.Hour)
+	viper.SetDefault("links.unlock_max_attempts", 5)
+	viper.SetDefault("links.unlock_window", 15*time.Minute)
+	viper.SetDefault("links.unverified_max_links", 5)
+	viper.SetDefault("worker.expiry_interval", time.Minute)
+	viper.SetDefault("worker.read_block", 5*time.Second)
+	viper.SetDefault("worker.shutdown_timeout", 30*time.Second)
+	viper.SetDefault("worker.batch_size", 100)
+	viper.SetDefault("worker.batch_max_wait", time.Second)
+	viper.SetDefault("worker.batch_retries", 3)
+	viper.SetDefault("worker.reclaim_interval", 30*time.Second)
+	viper.SetDefault("worker.reclaim_idle", time.Minute)
+	viper.SetDefault("worker.max_deliveries", 5)
+	viper.SetDefault("worker.consumers", 1)
+	viper.SetDefault("worker.consumer_idle_timeout", time.Hour)
+	viper.SetDefault("click_stream.name", "clicks_stream")
+	viper.SetDefault("click_stream.group", "clicks_group")
+	viper.SetDefault("click_stream.dead_letter", "clicks_stream_dead")
+	viper.SetDefault("click_stream.max_len", 1000000)
+	viper.SetDefault("click_stream.overflow_policy", "drop")
+	viper.SetDefault("click_stream.sample_rate", 0.1)
+	viper.SetDefault("click_stream.monitor_interval", 5*time.Second)
+	viper.SetDefault("privacy.ip_mode", "full")
+	viper.SetDefault("privacy.store_user_agent", true)
+	viper.SetDefault("privacy.retention_interval", time.Hour)
+	viper.SetDefault("privacy.retention_batch_size", 10000)
+	viper.SetDefault("analytics.visitor_ttl", 8*24*time.Hour)
+	viper.SetDefault("analytics.visitor_persist_interval", 5*time.Minute)
+	viper.SetDefault("live.max_subscribers_per_user", 5)
+	viper.SetDefault("live.max_subscribers", 200)
+	viper.SetDefault("live.heartbeat", 10*time.Second)
+	viper.SetDefault("live.stream_max_len", 1000)
+	viper.SetDefault("live.stream_ttl", time.Hour)
+	viper.SetDefault("export.dir", "exports")
+	viper.SetDefault("export.poll_interval", 5*time.Second)
+	viper.SetDefault("export.file_ttl", 24*time.Hour)
+	viper.SetDefault("export.stale_after", time.Hour)
+	viper.SetDefault("mail.driver", "log")
+	viper.SetDefault("mail.from", "Go-Shorty <no-reply@localhost>")
+	viper.SetDefault("mail.base_url", "http://localhost:8080")
+	viper.SetDefault("mail.smtp_port", 587)
+
 	viper.AutomaticEnv()
 
 	err = viper.ReadInConfig()
@@ -43,4 +121,171 @@ type RedisConfig struct {
 
 type AuthConfig struct {
 	SessionKey string `mapstructure:"session_key"`
+	// Login sessions are kept in Redis. A session ends after SessionIdleTimeout
+	// without requests, and SessionMaxAge after login however active it is.
+	SessionIdleTimeout time.Duration `mapstructure:"session_idle_timeout"`
+	SessionMaxAge      time.Duration `mapstructure:"session_max_age"`
+	// Login throttling, counted in sliding windows of LoginWindow. Each IP may
+	// try LoginIPLimit logins. After LoginDelayAfter failures for an email,
+	// further attempts wait LoginDelay, doubling up to LoginMaxDelay, and
+	// LoginLockoutAfter failures lock the email for LoginLockout. Unknown
+	// emails are treated like existing ones. Zero limits disable a check.
+	LoginWindow       time.Duration `mapstructure:"login_window"`
+	LoginIPLimit      int           `mapstructure:"login_ip_limit"`
+	LoginDelayAfter   int           `mapstructure:"login_delay_after"`
+	LoginDelay        time.Duration `mapstructure:"login_delay"`
+	LoginMaxDelay     time.Duration `mapstructure:"login_max_delay"`
+	LoginLockoutAfter int           `mapstructure:"login_lockout_after"`
+	LoginLockout      time.Duration `mapstructure:"login_lockout"`
+	// RegisterIPLimit is how many registrations each IP may attempt per
+	// RegisterWindow, and AccountEmailIPLimit how many verification and
+	// password reset emails it may request.
+	RegisterIPLimit     int           `mapstructure:"register_ip_limit"`
+	RegisterWindow      time.Duration `mapstructure:"register_window"`
+	AccountEmailIPLimit int           `mapstructure:"account_email_ip_limit"`
+	// How long emailed verification and password reset links stay valid.
+	VerifyTokenTTL time.Duration `mapstructure:"verify_token_ttl"`
+	ResetTokenTTL  time.Duration `mapstructure:"reset_token_ttl"`
+}
+
+// LinksConfig controls how short links behave when they are visited.
+type LinksConfig struct {
+	// UnlockMaxAttempts is how many wrong passwords an alias accepts per UnlockWindow.
+	UnlockMaxAttempts int           `mapstructure:"unlock_max_attempts"`
+	UnlockWindow      time.Duration `mapstructure:"unlock_window"`
+	// ExpiredPage is an optional HTML template served with 410 Gone for expired links.
+	ExpiredPage string `mapstructure:"expired_page"`
+	// UnverifiedMaxLinks caps the links of accounts whose email is not yet
+	// verified. Zero means no cap.
+	UnverifiedMaxLinks int `mapstructure:"unverified_max_links"`
+}
+
+// WorkerConfig controls the background jobs run by cmd/worker.
+type WorkerConfig struct {
+	// ExpiryInterval is how often links past their expires_at are marked expired.
+	ExpiryInterval time.Duration `mapstructure:"expiry_interval"`
+	// ReadBlock is how long a stream read waits for new messages before checking for shutdown.
+	ReadBlock time.Duration `mapstructure:"read_block"`
+	// BatchSize is the most clicks written in one COPY; BatchMaxWait is how long
+	// a partial batch may wait for more messages before it is written anyway.
+	BatchSize    int           `mapstructure:"batch_size"`
+	BatchMaxWait time.Duration `mapstructure:"batch_max_wait"`
+	// BatchRetries is how often a batch is retried after a transient database error.
+	BatchRetries int `mapstructure:"batch_retries"`
+	// ReclaimInterval is how often the pending entries list is scanned for
+	// messages idle longer than ReclaimIdle. Messages delivered more than
+	// MaxDeliveries times are moved to the dead-letter stream.
+	ReclaimInterval time.Duration `mapstructure:"reclaim_interval"`
+	ReclaimIdle     time.Duration `mapstructure:"reclaim_idle"`
+	MaxDeliveries   int           `mapstructure:"max_deliveries"`
+	// ShutdownTimeout bounds how long the current batch may take to finish on shutdown.
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// ConsumerName prefixes the consumer names of this process. When empty it
+	// defaults to hostname-pid so that every replica has its own identity.
+	ConsumerName string `mapstructure:"consumer_name"`
+	// Consumers is the number of consumer goroutines run by this process.
+	Consumers int `mapstructure:"consumers"`
+	// ConsumerIdleTimeout is how long a consumer with nothing pending may stay
+	// idle before it is removed from the group as dead.
+	ConsumerIdleTimeout time.Duration `mapstructure:"consumer_idle_timeout"`
+	// GeoIPPath is a local MaxMind-format (.mmdb) city database used to add
+	// country, region and city to clicks. It is reloaded when the file
+	// changes. Leave empty to store clicks without location.
+	GeoIPPath string `mapstructure:"geoip_path"`
+}
+
+type ClickStreamConfig struct {
+	Name       string `mapstructure:"name"`
+	Group      string `mapstructure:"group"`
+	DeadLetter string `mapstructure:"dead_letter"`
+	// Trimming applied on every XADD. MaxAge (MINID) wins over MaxLen (MAXLEN)
+	// when both are set; both use approximate "~" trimming. Trimmed entries are
+	// lost even if the worker has not read them yet, so keep HighWaterMark well
+	// below MaxLen.
+	MaxLen int64         `mapstructure:"max_len"`
+	MaxAge time.Duration `mapstructure:"max_age"`
+	// HighWaterMark is the backlog (undelivered plus unacknowledged entries) at
+	// which the server stops adding every click and applies OverflowPolicy:
+	// "drop", "sample" (keep SampleRate of events) or "spill" (append to the
+	// file at SpillPath and replay once the backlog drops). Zero disables it.
+	HighWaterMark  int64   `mapstructure:"high_water_mark"`
+	OverflowPolicy string  `mapstructure:"overflow_policy"`
+	SampleRate     float64 `mapstructure:"sample_rate"`
+	SpillPath      string  `mapstructure:"spill_path"`
+	// MonitorInterval is how often stream depth and consumer lag are sampled.
+	MonitorInterval time.Duration `mapstructure:"monitor_interval"`
+}
+
+// PrivacyConfig controls what the worker keeps about visitors.
+type PrivacyConfig struct {
+	// IPMode is how click IPs are stored: "full", "truncate" (/24 for IPv4,
+	// /48 for IPv6) or "hash" (HMAC with a salt that rotates daily, so visitors
+	// can be counted within a day but not followed across days). Users may
+	// pick a different mode for their own links.
+	IPMode string `mapstructure:"ip_mode"`
+	// StoreUserAgent keeps the raw User-Agent next to the parsed browser, OS and device.
+	StoreUserAgent bool `mapstructure:"store_user_agent"`
+	// RetentionDays is how long raw clicks are kept before the worker deletes
+	// them; their counts stay in the rollups. Zero keeps them forever.
+	RetentionDays      int           `mapstructure:"retention_days"`
+	RetentionInterval  time.Duration `mapstructure:"retention_interval"`
+	RetentionBatchSize int32         `mapstructure:"retention_batch_size"`
+}
+
+// AnalyticsConfig controls how unique visitors are counted.
+type AnalyticsConfig struct {
+	// VisitorTTL is how long a daily HyperLogLog stays in Redis after its last
+	// visit. Older days are restored from Postgres when they are counted.
+	VisitorTTL time.Duration `mapstructure:"visitor_ttl"`
+	// VisitorPersistInterval is how often the worker copies changed
+	// HyperLogLogs to Postgres.
+	VisitorPersistInterval time.Duration `mapstructure:"visitor_persist_interval"`
+}
+
+// LiveConfig controls the real-time click feed.
+type LiveConfig struct {
+	// MaxSubscribersPerUser caps concurrent live connections per user. Each
+	// one holds a Redis connection while it waits for clicks.
+	MaxSubscribersPerUser int `mapstructure:"max_subscribers_per_user"`
+	// MaxSubscribers caps live connections per server replica. The server
+	// reads live streams through its own Redis pool of this size, so open
+	// streams never take connections from redirects.
+	MaxSubscribers int `mapstructure:"max_subscribers"`
+	// Heartbeat is how often an idle connection gets a keep-alive comment. On
+	// shutdown, streams end within one heartbeat, so keep it below
+	// server.shutdown_timeout.
+	Heartbeat time.Duration `mapstructure:"heartbeat"`
+	// StreamMaxLen and StreamTTL bound each link's live stream, and with it
+	// how far back a reconnecting client can resume.
+	StreamMaxLen int64         `mapstructure:"stream_max_len"`
+	StreamTTL    time.Duration `mapstructure:"stream_ttl"`
+}
+
+// ExportConfig controls the analytics exports run as worker jobs.
+type ExportConfig struct {
+	// Dir holds the finished export files. The server reads them from the
+	// same path, so it must be shared with the worker.
+	Dir string `mapstructure:"dir"`
+	// PollInterval is how often the worker looks for new export jobs.
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// FileTTL is how long a finished export can be downloaded before it is deleted.
+	FileTTL time.Duration `mapstructure:"file_ttl"`
+	// StaleAfter is how long a job may run before another worker takes it over,
+	// e.g. because the one running it crashed.
+	StaleAfter time.Duration `mapstructure:"stale_after"`
+}
+
+// MailConfig controls how account emails (verification, password reset) are sent.
+type MailConfig struct {
+	// Driver is "smtp", or "log" to write emails to FilePath instead, or to
+	// the server log when FilePath is empty. Use "log" for local development.
+	Driver string `mapstructure:"driver"`
+	From   string `mapstructure:"from"`
+	// BaseURL is where users open the links in emails, e.g. "https://sho.rt".
+	BaseURL      string `mapstructure:"base_url"`
+	SMTPHost     string `mapstructure:"smtp_host"`
+	SMTPPort     int    `mapstructure:"smtp_port"`
+	SMTPUsername string `mapstructure:"smtp_username"`
+	SMTPPassword string `mapstructure:"smtp_password"`
+	FilePath     string `mapstructure:"file_path"`
 }
\ No newline at end of file
@@ -2,11 +2,20 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/sumanthd032/go-shorty/internal/middleware"
 	"github.com/sumanthd032/go-shorty/internal/repositories/db"
+	"github.com/sumanthd032/go-shorty/internal/services"
 )
 
 // AnalyticsResponse defines the JSON structure for the analytics data.
@@ -16,16 +25,47 @@ type AnalyticsResponse struct {
 	Alias       string `json:"alias"`
 	OriginalURL string `json:"original_url"`
 	TotalClicks int64  `json:"total_clicks"`
+	// UniqueVisitors is estimated over the requested range, not all time.
+	// Bots are never counted as visitors.
+	UniqueVisitors int64 `json:"unique_visitors"`
+	// LinkPreviews counts fetches by chat and social apps unfurling the link.
+	// They are not part of TotalClicks unless bots are included.
+	LinkPreviews int64 `json:"link_previews"`
 }
 
 type AnalyticsHandler struct {
-	queries *db.Queries
+	queries  *db.Queries
+	visitors *services.VisitorCounter
+	// retentionDays is how long the worker keeps raw clicks; 0 keeps them
+	// forever.
+	retentionDays int
 }
 
-func NewAnalyticsHandler(queries *db.Queries) *AnalyticsHandler {
-	return &AnalyticsHandler{queries: queries}
+func NewAnalyticsHandler(queries *db.Queries, visitors *services.VisitorCounter, retentionDays int) *AnalyticsHandler {
+	return &AnalyticsHandler{queries: queries, visitors: visitors, retentionDays: retentionDays}
 }
 
+// clampToRetention moves from forward to the oldest raw click still kept, for
+// queries that read the raw clicks table. It returns the cutoff when the range
+// was clamped, so the response can say so.
+func (h *AnalyticsHandler) clampToRetention(from, to time.Time) (time.Time, *time.Time) {
+	if h.retentionDays <= 0 {
+		return from, nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -h.retentionDays)
+	if !from.Before(cutoff) {
+		return from, nil
+	}
+	if cutoff.After(to) {
+		cutoff = to
+	}
+	return cutoff, &cutoff
+}
+
+// GetAnalytics lists the user's links with their all-time click totals and
+// the unique visitors between from and to (last 30 days by default).
+//
+//	GET /api/analytics?from=&to=&include_bots=
 func (h *AnalyticsHandler) GetAnalytics(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
 	if !ok {
@@ -33,8 +73,39 @@ func (h *AnalyticsHandler) GetAnalytics(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	dbAnalytics, err := h.queries.GetLinkAnalytics(r.Context(), pgtype.Int8{Int64: userID, Valid: true})
+	query := r.URL.Query()
+	from, to, err := parseTimeRange(query.Get("from"), query.Get("to"), time.UTC, 30*24*time.Hour)
 	if err != nil {
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	includeBots, err := parseIncludeBots(query.Get("include_bots"))
+	if err != nil {
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	dbAnalytics, err := h.queries.GetLinkAnalytics(r.Context(), db.GetLinkAnalyticsParams{
+		IncludeBots: includeBots,
+		UserID:      pgtype.Int8{Int64: userID, Valid: true},
+	})
+	if err != nil {
+		http.Error(w, `{"error":"Could not fetch analytics"}`, http.StatusInternalServerError)
+		return
+	}
+
+	linkIDs := make([]int64, 0, len(dbAnalytics))
+	for _, item := range dbAnalytics {
+		linkIDs = append(linkIDs, item.ID)
+	}
+	visitors, err := h.visitors.Count(r.Context(), linkIDs, from, to)
+	if err != nil {
+		if errors.Is(err, services.ErrVisitorRangeTooLarge) {
+			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+			return
+		}
+		log.Printf("Failed to count unique visitors for user %d: %v", userID, err)
 		http.Error(w, `{"error":"Could not fetch analytics"}`, http.StatusInternalServerError)
 		return
 	}
@@ -43,14 +114,464 @@ func (h *AnalyticsHandler) GetAnalytics(w http.ResponseWriter, r *http.Request)
 	apiAnalytics := make([]AnalyticsResponse, 0, len(dbAnalytics))
 	for _, item := range dbAnalytics {
 		apiAnalytics = append(apiAnalytics, AnalyticsResponse{
-			ID:          item.ID,
-			Alias:       item.Alias,
-			OriginalURL: item.OriginalUrl,
-			TotalClicks: item.TotalClicks,
+			ID:             item.ID,
+			Alias:          item.Alias,
+			OriginalURL:    item.OriginalUrl,
+			TotalClicks:    item.TotalClicks,
+			UniqueVisitors: visitors[item.ID],
+			LinkPreviews:   item.LinkPreviews,
 		})
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(apiAnalytics)
-}
\ No newline at end of file
+}
+
+// TimeseriesBucket is one point of a click timeseries. Start is rendered in the
+// requested time zone.
+type TimeseriesBucket struct {
+	Start  string `json:"start"`
+	Clicks int64  `json:"clicks"`
+}
+
+type TimeseriesResponse struct {
+	LinkID      int64  `json:"link_id"`
+	Interval    string `json:"interval"`
+	TZ          string `json:"tz"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	IncludeBots bool   `json:"include_bots"`
+	// RetentionCutoff is set when From was moved forward because older raw
+	// clicks have been deleted.
+	RetentionCutoff string             `json:"retention_cutoff,omitempty"`
+	Total           int64              `json:"total"`
+	Buckets         []TimeseriesBucket `json:"buckets"`
+}
+
+// timeseriesIntervals maps the accepted interval names to an approximate bucket
+// width, used only to cap the number of buckets a request may ask for.
+var timeseriesIntervals = map[string]time.Duration{
+	"hour":  time.Hour,
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+}
+
+const maxTimeseriesBuckets = 2000
+
+// GetLinkTimeseries returns zero-filled click counts for one link, bucketed by
+// hour, day, week or month in the caller's time zone.
+//
+//	GET /api/analytics/links/{id}/timeseries?from=&to=&interval=&tz=&include_bots=
+//
+// from and to accept RFC 3339 timestamps or YYYY-MM-DD dates (midnight in tz).
+// They default to the last 30 days; interval defaults to day and tz to UTC.
+// Bots are left out unless include_bots is true. Counts come from the hourly
+// rollups, with the range widened to whole hours, unless tz is not a whole
+// number of hours from UTC; then the raw clicks are counted, and a range
+// starting before the retention cutoff is clamped to it and the cutoff is
+// returned as retention_cutoff.
+func (h *AnalyticsHandler) GetLinkTimeseries(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not authenticated"}`, http.StatusInternalServerError)
+		return
+	}
+
+	linkID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid link ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	interval := query.Get("interval")
+	if interval == "" {
+		interval = "day"
+	}
+	width, ok := timeseriesIntervals[interval]
+	if !ok {
+		http.Error(w, `{"error":"interval must be one of hour, day, week, month"}`, http.StatusBadRequest)
+		return
+	}
+
+	tz := query.Get("tz")
+	if tz == "" {
+		tz = "UTC"
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		http.Error(w, `{"error":"Unknown time zone"}`, http.StatusBadRequest)
+		return
+	}
+
+	from, to, err := parseTimeRange(query.Get("from"), query.Get("to"), loc, 30*24*time.Hour)
+	if err != nil {
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from)/width > maxTimeseriesBuckets {
+		http.Error(w, `{"error":"Range too large for the requested interval"}`, http.StatusBadRequest)
+		return
+	}
+
+	includeBots, err := parseIncludeBots(query.Get("include_bots"))
+	if err != nil {
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.queries.GetLinkByIDForUser(r.Context(), db.GetLinkByIDForUserParams{
+		ID:     linkID,
+		UserID: pgtype.Int8{Int64: userID, Valid: true},
+	}); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, `{"error":"Link not found"}`, http.StatusNotFound)
+			return
+		}
+		http.Error(w, `{"error":"Could not fetch analytics"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var rows []db.GetLinkClickTimeseriesRow
+	var cutoff *time.Time
+	if rollupFrom, rollupTo, ok := hourlyRollupRange(from, to, loc); ok {
+		from, to = rollupFrom, rollupTo
+		var rollupRows []db.GetLinkRollupTimeseriesRow
+		rollupRows, err = h.queries.GetLinkRollupTimeseries(r.Context(), db.GetLinkRollupTimeseriesParams{
+			Bucket:      interval,
+			FromTime:    pgtype.Timestamptz{Time: from, Valid: true},
+			Tz:          loc.String(),
+			ToTime:      pgtype.Timestamptz{Time: to, Valid: true},
+			LinkID:      linkID,
+			IncludeBots: includeBots,
+		})
+		for _, row := range rollupRows {
+			rows = append(rows, db.GetLinkClickTimeseriesRow(row))
+		}
+	} else {
+		from, cutoff = h.clampToRetention(from, to)
+		rows, err = h.queries.GetLinkClickTimeseries(r.Context(), db.GetLinkClickTimeseriesParams{
+			Bucket:      interval,
+			FromTime:    pgtype.Timestamptz{Time: from, Valid: true},
+			Tz:          loc.String(),
+			ToTime:      pgtype.Timestamptz{Time: to, Valid: true},
+			LinkID:      linkID,
+			IncludeBots: includeBots,
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to fetch timeseries for link %d: %v", linkID, err)
+		http.Error(w, `{"error":"Could not fetch analytics"}`, http.StatusInternalServerError)
+		return
+	}
+
+	resp := TimeseriesResponse{
+		LinkID:      linkID,
+		Interval:    interval,
+		TZ:          loc.String(),
+		From:        from.In(loc).Format(time.RFC3339),
+		To:          to.In(loc).Format(time.RFC3339),
+		IncludeBots: includeBots,
+		Buckets:     make([]TimeseriesBucket, 0, len(rows)),
+	}
+	if cutoff != nil {
+		resp.RetentionCutoff = cutoff.In(loc).Format(time.RFC3339)
+	}
+	for _, row := range rows {
+		resp.Total += row.Clicks
+		resp.Buckets = append(resp.Buckets, TimeseriesBucket{
+			Start:  row.BucketStart.Time.In(loc).Format(time.RFC3339),
+			Clicks: row.Clicks,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// parseTimeRange reads optional from/to query values. Missing values default
+// to [now-defaultSpan, now). Bare dates are taken as midnight in loc.
+func parseTimeRange(fromValue, toValue string, loc *time.Location, defaultSpan time.Duration) (time.Time, time.Time, error) {
+	to := time.Now()
+	if toValue != "" {
+		t, err := parseTimeParam(toValue, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("to must be an RFC 3339 timestamp or YYYY-MM-DD date")
+		}
+		to = t
+	}
+
+	from := to.Add(-defaultSpan)
+	if fromValue != "" {
+		t, err := parseTimeParam(fromValue, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("from must be an RFC 3339 timestamp or YYYY-MM-DD date")
+		}
+		from = t
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("from must be before to")
+	}
+	return from, to, nil
+}
+
+// parseIncludeBots reads the include_bots query value, which defaults to false.
+func parseIncludeBots(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	include, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New("include_bots must be true or false")
+	}
+	return include, nil
+}
+
+// hourlyRollupRange widens [from, to) to whole hours and reports whether the
+// hourly rollups can answer it in loc, i.e. every UTC hour of the range falls
+// within a single hour of loc.
+func hourlyRollupRange(from, to time.Time, loc *time.Location) (time.Time, time.Time, bool) {
+	from = from.Truncate(time.Hour)
+	if rounded := to.Truncate(time.Hour); rounded.Before(to) {
+		to = rounded.Add(time.Hour)
+	}
+
+	for t := from; t.Before(to); {
+		_, offset := t.In(loc).Zone()
+		if offset%3600 != 0 {
+			return from, to, false
+		}
+		_, end := t.In(loc).ZoneBounds()
+		if end.IsZero() {
+			break
+		}
+		t = end
+	}
+	return from, to, true
+}
+
+func parseTimeParam(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(time.DateOnly, value, loc)
+}
+
+// BreakdownItem is one value of a breakdown dimension and its click count.
+type BreakdownItem struct {
+	Value  string `json:"value"`
+	Clicks int64  `json:"clicks"`
+}
+
+type BreakdownResponse struct {
+	LinkID      int64  `json:"link_id"`
+	Dimension   string `json:"dimension"`
+	Country     string `json:"country,omitempty"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	IncludeBots bool   `json:"include_bots"`
+	// RetentionCutoff is set when From was moved forward because older raw
+	// clicks have been deleted.
+	RetentionCutoff string          `json:"retention_cutoff,omitempty"`
+	Total           int64           `json:"total"`
+	Items           []BreakdownItem `json:"items"`
+}
+
+// breakdownDimensions maps each dimension to the label used for clicks where
+// it is missing, e.g. clicks recorded before the column existed.
+var breakdownDimensions = map[string]string{
+	"browser":  "Unknown",
+	"os":       "Unknown",
+	"device":   "unknown",
+	"referrer": "Direct",
+	"country":  "Unknown",
+	"region":   "Unknown",
+	"city":     "Unknown",
+	"bot":      "Unknown",
+}
+
+// rollupDimensions are the breakdown dimensions kept in the click rollups.
+var rollupDimensions = map[string]bool{
+	"country":  true,
+	"device":   true,
+	"referrer": true,
+}
+
+const (
+	defaultBreakdownLimit = 10
+	maxBreakdownLimit     = 100
+	breakdownOtherLabel   = "Other"
+)
+
+// GetLinkBreakdown returns the top values of one click dimension for a link.
+// Everything past the first limit values is summed into an "Other" item.
+//
+//	GET /api/analytics/links/{id}/breakdown/{dimension}?from=&to=&limit=&country=&include_bots=
+//
+// dimension is one of browser, os, device, referrer, country, region, city or
+// bot. The range defaults to the last 30 days and limit to 10. country
+// restricts the clicks counted to one ISO country code, e.g. to list the
+// cities of a single country. Bots are left out unless include_bots is true;
+// the bot dimension lists only bots. Country, device and referrer are read
+// from the hourly rollups, with the range widened to whole hours. The other
+// dimensions count raw clicks, so a range starting before the retention
+// cutoff is clamped to it and the cutoff is returned as retention_cutoff.
+func (h *AnalyticsHandler) GetLinkBreakdown(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not authenticated"}`, http.StatusInternalServerError)
+		return
+	}
+
+	linkID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid link ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	dimension := chi.URLParam(r, "dimension")
+	missingLabel, ok := breakdownDimensions[dimension]
+	if !ok {
+		http.Error(w, `{"error":"dimension must be one of browser, os, device, referrer, country, region, city, bot"}`, http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := defaultBreakdownLimit
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxBreakdownLimit {
+			http.Error(w, `{"error":"limit must be between 1 and 100"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	from, to, err := parseTimeRange(query.Get("from"), query.Get("to"), time.UTC, 30*24*time.Hour)
+	if err != nil {
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	country := strings.ToUpper(query.Get("country"))
+	if country != "" && len(country) != 2 {
+		http.Error(w, `{"error":"country must be a two-letter ISO code"}`, http.StatusBadRequest)
+		return
+	}
+
+	includeBots, err := parseIncludeBots(query.Get("include_bots"))
+	if err != nil {
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+	if dimension == "bot" {
+		includeBots = true
+	}
+
+	if _, err := h.queries.GetLinkByIDForUser(r.Context(), db.GetLinkByIDForUserParams{
+		ID:     linkID,
+		UserID: pgtype.Int8{Int64: userID, Valid: true},
+	}); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, `{"error":"Link not found"}`, http.StatusNotFound)
+			return
+		}
+		http.Error(w, `{"error":"Could not fetch analytics"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var rows []db.GetLinkClickBreakdownRow
+	var cutoff *time.Time
+	if rollupDimensions[dimension] {
+		from, to, _ = hourlyRollupRange(from, to, time.UTC)
+		var rollupRows []db.GetLinkRollupBreakdownRow
+		rollupRows, err = h.queries.GetLinkRollupBreakdown(r.Context(), db.GetLinkRollupBreakdownParams{
+			Dimension:   dimension,
+			LinkID:      linkID,
+			FromTime:    pgtype.Timestamptz{Time: from, Valid: true},
+			ToTime:      pgtype.Timestamptz{Time: to, Valid: true},
+			Country:     pgtype.Text{String: country, Valid: country != ""},
+			IncludeBots: includeBots,
+		})
+		for _, row := range rollupRows {
+			rows = append(rows, db.GetLinkClickBreakdownRow(row))
+		}
+	} else {
+		from, cutoff = h.clampToRetention(from, to)
+		rows, err = h.queries.GetLinkClickBreakdown(r.Context(), db.GetLinkClickBreakdownParams{
+			Dimension:   dimension,
+			LinkID:      linkID,
+			FromTime:    pgtype.Timestamptz{Time: from, Valid: true},
+			ToTime:      pgtype.Timestamptz{Time: to, Valid: true},
+			Country:     pgtype.Text{String: country, Valid: country != ""},
+			IncludeBots: includeBots,
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to fetch %s breakdown for link %d: %v", dimension, linkID, err)
+		http.Error(w, `{"error":"Could not fetch analytics"}`, http.StatusInternalServerError)
+		return
+	}
+
+	resp := BreakdownResponse{
+		LinkID:      linkID,
+		Dimension:   dimension,
+		Country:     country,
+		From:        from.UTC().Format(time.RFC3339),
+		To:          to.UTC().Format(time.RFC3339),
+		IncludeBots: includeBots,
+		Items:       topBreakdownItems(rows, missingLabel, limit),
+	}
+	if cutoff != nil {
+		resp.RetentionCutoff = cutoff.UTC().Format(time.RFC3339)
+	}
+	for _, item := range resp.Items {
+		resp.Total += item.Clicks
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// topBreakdownItems labels missing values, keeps the limit largest values and
+// folds the rest into an "Other" item. rows must be sorted by clicks.
+func topBreakdownItems(rows []db.GetLinkClickBreakdownRow, missingLabel string, limit int) []BreakdownItem {
+	items := make([]BreakdownItem, 0, len(rows))
+	index := make(map[string]int, len(rows))
+	for _, row := range rows {
+		value := row.Value
+		if value == "" {
+			value = missingLabel
+		}
+		// Rows stored before parsing existed and rows the parser could not
+		// classify share a label, so merge them.
+		if i, ok := index[value]; ok {
+			items[i].Clicks += row.Clicks
+			continue
+		}
+		index[value] = len(items)
+		items = append(items, BreakdownItem{Value: value, Clicks: row.Clicks})
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Clicks > items[j].Clicks })
+
+	if len(items) <= limit {
+		return items
+	}
+	var rest int64
+	for _, item := range items[limit:] {
+		rest += item.Clicks
+	}
+	items = items[:limit]
+	// The parsers report unrecognised values as "Other" too; fold into it.
+	for i := range items {
+		if items[i].Value == breakdownOtherLabel {
+			items[i].Clicks += rest
+			return items
+		}
+	}
+	return append(items, BreakdownItem{Value: breakdownOtherLabel, Clicks: rest})
+}
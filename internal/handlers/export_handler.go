@@ -0,0 +1,454 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sumanthd032/go-shorty/internal/middleware"
+	"github.com/sumanthd032/go-shorty/internal/repositories/db"
+	"github.com/sumanthd032/go-shorty/internal/services"
+)
+
+// maxActiveExports caps the export jobs a user may have queued or running.
+const maxActiveExports = 5
+
+// A streamed export holds a database connection until the client has read
+// it, so only a few run at once and clients that stop reading for
+// exportWriteTimeout are dropped.
+const (
+	maxStreamedExports        = 4
+	maxStreamedExportsPerUser = 1
+	exportWriteTimeout        = 30 * time.Second
+)
+
+var (
+	errExportLinkNotFound = errors.New("link not found")
+	errTooManyExports     = errors.New("too many exports in progress")
+)
+
+type ExportHandler struct {
+	pool     *pgxpool.Pool
+	queries  *db.Queries
+	exporter *services.Exporter
+	// dir is where the worker leaves finished export files.
+	dir string
+
+	mu        sync.Mutex
+	streaming map[int64]int
+	streams   int
+}
+
+func NewExportHandler(pool *pgxpool.Pool, queries *db.Queries, exporter *services.Exporter, dir string) *ExportHandler {
+	return &ExportHandler{pool: pool, queries: queries, exporter: exporter, dir: dir, streaming: make(map[int64]int)}
+}
+
+// ExportJobRequest is the body of POST /api/analytics/exports. The fields
+// mean the same as the query parameters of GET /api/analytics/export.
+type ExportJobRequest struct {
+	Format  string `json:"format"`
+	Dataset string `json:"dataset"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	LinkID  int64  `json:"link_id"`
+}
+
+type ExportJobResponse struct {
+	ID          int64  `json:"id"`
+	Status      string `json:"status"`
+	Format      string `json:"format"`
+	Dataset     string `json:"dataset"`
+	LinkID      *int64 `json:"link_id,omitempty"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Rows        int64  `json:"rows"`
+	Error       string `json:"error,omitempty"`
+	CreatedAt   string `json:"created_at"`
+	FinishedAt  string `json:"finished_at,omitempty"`
+	ExpiresAt   string `json:"expires_at,omitempty"`
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+// Export streams the user's click data as it is read from the database.
+//
+//	GET /api/analytics/export?format=csv|ndjson&dataset=clicks|daily&from=&to=&link_id=
+//
+// format defaults to csv. dataset clicks (the default) exports one row per
+// raw click; daily exports the daily rollups, which also cover clicks removed
+// by the retention job. The range defaults to the last 30 days and link_id to
+// all of the user's links. For very large exports, queue a job with
+// POST /api/analytics/exports instead: only maxStreamedExports stream at once
+// (maxStreamedExportsPerUser per user), and clients that stop reading are
+// disconnected.
+func (h *ExportHandler) Export(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not authenticated"}`, http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	var linkID int64
+	if value := query.Get("link_id"); value != "" {
+		var err error
+		linkID, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, `{"error":"Invalid link ID"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	req, status, err := h.exportRequest(r.Context(), userID, ExportJobRequest{
+		Format:  query.Get("format"),
+		Dataset: query.Get("dataset"),
+		From:    query.Get("from"),
+		To:      query.Get("to"),
+		LinkID:  linkID,
+	})
+	if err != nil {
+		http.Error(w, `{"error":"`+err.Error()+`"}`, status)
+		return
+	}
+
+	if !h.acquireStream(userID) {
+		http.Error(w, `{"error":"Too many exports in progress, queue one with POST /api/analytics/exports"}`, http.StatusTooManyRequests)
+		return
+	}
+	defer h.releaseStream(userID)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", services.ExportContentType(req.Format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+req.FileName()+`"`)
+	w.WriteHeader(http.StatusOK)
+	out := &deadlineWriter{w: w, rc: rc, timeout: exportWriteTimeout}
+	_, err = h.exporter.Write(r.Context(), out, req)
+	if err == nil {
+		err = out.flush()
+	}
+	if err != nil {
+		log.Printf("Export for user %d failed: %v", userID, err)
+		// The status is already sent. Abort the connection so the client
+		// sees a broken download rather than a complete-looking file.
+		panic(http.ErrAbortHandler)
+	}
+	// The server sets no write deadline of its own, so clear ours before the
+	// connection is reused.
+	rc.SetWriteDeadline(time.Time{})
+}
+
+// acquireStream takes a slot for a streamed export, or reports false when the
+// server or the user is at the limit.
+func (h *ExportHandler) acquireStream(userID int64) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.streams >= maxStreamedExports || h.streaming[userID] >= maxStreamedExportsPerUser {
+		return false
+	}
+	h.streams++
+	h.streaming[userID]++
+	return true
+}
+
+func (h *ExportHandler) releaseStream(userID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.streams--
+	if h.streaming[userID]--; h.streaming[userID] <= 0 {
+		delete(h.streaming, userID)
+	}
+}
+
+// deadlineWriter gives every write to the client timeout to complete, so a
+// client that stops reading fails the export instead of holding its database
+// connection indefinitely.
+type deadlineWriter struct {
+	w       io.Writer
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	if err := d.rc.SetWriteDeadline(time.Now().Add(d.timeout)); err != nil {
+		return 0, err
+	}
+	return d.w.Write(p)
+}
+
+// flush sends what the response still buffers while the deadline applies.
+func (d *deadlineWriter) flush() error {
+	if err := d.rc.SetWriteDeadline(time.Now().Add(d.timeout)); err != nil {
+		return err
+	}
+	return d.rc.Flush()
+}
+
+// CreateExport queues an export for the worker and returns the job. Poll
+// GET /api/analytics/exports/{id} until its status is done, then fetch its
+// download_url.
+//
+//	POST /api/analytics/exports
+func (h *ExportHandler) CreateExport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not authenticated"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var body ExportJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	req, status, err := h.exportRequest(r.Context(), userID, body)
+	if err != nil {
+		http.Error(w, `{"error":"`+err.Error()+`"}`, status)
+		return
+	}
+
+	job, err := h.createJob(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, errTooManyExports) {
+			http.Error(w, `{"error":"Too many exports in progress"}`, http.StatusTooManyRequests)
+			return
+		}
+		log.Printf("Failed to create export job for user %d: %v", userID, err)
+		http.Error(w, `{"error":"Could not create export"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/api/analytics/exports/%d", job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(exportJobResponse(job))
+}
+
+// createJob inserts the job unless the user already has maxActiveExports
+// queued or running. The count and the insert run under a per-user lock, so
+// concurrent requests cannot exceed the cap between them.
+func (h *ExportHandler) createJob(ctx context.Context, req services.ExportRequest) (db.ExportJob, error) {
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return db.ExportJob{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.queries.WithTx(tx)
+	if err := qtx.LockExportJobsForUser(ctx, req.UserID); err != nil {
+		return db.ExportJob{}, err
+	}
+	active, err := qtx.CountActiveExportJobsForUser(ctx, req.UserID)
+	if err != nil {
+		return db.ExportJob{}, err
+	}
+	if active >= maxActiveExports {
+		return db.ExportJob{}, errTooManyExports
+	}
+	job, err := qtx.CreateExportJob(ctx, db.CreateExportJobParams{
+		UserID:   req.UserID,
+		Dataset:  req.Dataset,
+		Format:   req.Format,
+		LinkID:   pgtype.Int8{Int64: req.LinkID, Valid: req.LinkID != 0},
+		FromTime: pgtype.Timestamptz{Time: req.From, Valid: true},
+		ToTime:   pgtype.Timestamptz{Time: req.To, Valid: true},
+	})
+	if err != nil {
+		return db.ExportJob{}, err
+	}
+	return job, tx.Commit(ctx)
+}
+
+// ListExports returns the user's 50 most recent export jobs.
+//
+//	GET /api/analytics/exports
+func (h *ExportHandler) ListExports(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not authenticated"}`, http.StatusInternalServerError)
+		return
+	}
+
+	jobs, err := h.queries.ListExportJobsForUser(r.Context(), userID)
+	if err != nil {
+		http.Error(w, `{"error":"Could not fetch exports"}`, http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]ExportJobResponse, 0, len(jobs))
+	for _, job := range jobs {
+		resp = append(resp, exportJobResponse(job))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetExport returns one export job.
+//
+//	GET /api/analytics/exports/{id}
+func (h *ExportHandler) GetExport(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.userExportJob(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(exportJobResponse(job))
+}
+
+// DownloadExport serves the file of a finished export job.
+//
+//	GET /api/analytics/exports/{id}/download
+func (h *ExportHandler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.userExportJob(w, r)
+	if !ok {
+		return
+	}
+	if job.Status != services.ExportStatusDone {
+		http.Error(w, `{"error":"Export is not ready"}`, http.StatusConflict)
+		return
+	}
+
+	// Only the base name is used so a tampered row cannot point outside dir.
+	f, err := os.Open(filepath.Join(h.dir, filepath.Base(job.FileName.String)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, `{"error":"Export has expired"}`, http.StatusGone)
+			return
+		}
+		log.Printf("Failed to open export %d: %v", job.ID, err)
+		http.Error(w, `{"error":"Could not fetch export"}`, http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, `{"error":"Could not fetch export"}`, http.StatusInternalServerError)
+		return
+	}
+
+	req := exportJobRequest(job)
+	w.Header().Set("Content-Type", services.ExportContentType(req.Format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+req.FileName()+`"`)
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+// exportRequest validates body and fills in its defaults. On failure it
+// returns the HTTP status to answer with.
+func (h *ExportHandler) exportRequest(ctx context.Context, userID int64, body ExportJobRequest) (services.ExportRequest, int, error) {
+	req := services.ExportRequest{
+		UserID:  userID,
+		Format:  body.Format,
+		Dataset: body.Dataset,
+		LinkID:  body.LinkID,
+	}
+	if req.Format == "" {
+		req.Format = services.ExportFormatCSV
+	}
+	if req.Dataset == "" {
+		req.Dataset = services.ExportDatasetClicks
+	}
+	if err := req.Validate(); err != nil {
+		return req, http.StatusBadRequest, err
+	}
+
+	from, to, err := parseTimeRange(body.From, body.To, time.UTC, 30*24*time.Hour)
+	if err != nil {
+		return req, http.StatusBadRequest, err
+	}
+	req.From, req.To = from, to
+
+	if req.LinkID != 0 {
+		if _, err := h.queries.GetLinkByIDForUser(ctx, db.GetLinkByIDForUserParams{
+			ID:     req.LinkID,
+			UserID: pgtype.Int8{Int64: userID, Valid: true},
+		}); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return req, http.StatusNotFound, errExportLinkNotFound
+			}
+			return req, http.StatusInternalServerError, errors.New("could not fetch link")
+		}
+	}
+	return req, 0, nil
+}
+
+// userExportJob loads the export job named in the URL if it belongs to the
+// user, and writes the error response otherwise.
+func (h *ExportHandler) userExportJob(w http.ResponseWriter, r *http.Request) (db.ExportJob, bool) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not authenticated"}`, http.StatusInternalServerError)
+		return db.ExportJob{}, false
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid export ID"}`, http.StatusBadRequest)
+		return db.ExportJob{}, false
+	}
+
+	job, err := h.queries.GetExportJobForUser(r.Context(), db.GetExportJobForUserParams{ID: id, UserID: userID})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, `{"error":"Export not found"}`, http.StatusNotFound)
+			return db.ExportJob{}, false
+		}
+		http.Error(w, `{"error":"Could not fetch export"}`, http.StatusInternalServerError)
+		return db.ExportJob{}, false
+	}
+	return job, true
+}
+
+func exportJobRequest(job db.ExportJob) services.ExportRequest {
+	return services.ExportRequest{
+		UserID:  job.UserID,
+		Dataset: job.Dataset,
+		Format:  job.Format,
+		LinkID:  job.LinkID.Int64,
+		From:    job.FromTime.Time,
+		To:      job.ToTime.Time,
+	}
+}
+
+func exportJobResponse(job db.ExportJob) ExportJobResponse {
+	resp := ExportJobResponse{
+		ID:        job.ID,
+		Status:    job.Status,
+		Format:    job.Format,
+		Dataset:   job.Dataset,
+		From:      job.FromTime.Time.UTC().Format(time.RFC3339),
+		To:        job.ToTime.Time.UTC().Format(time.RFC3339),
+		Rows:      job.RowCount,
+		Error:     job.Error.String,
+		CreatedAt: job.CreatedAt.Time.UTC().Format(time.RFC3339),
+	}
+	if job.LinkID.Valid {
+		resp.LinkID = &job.LinkID.Int64
+	}
+	if job.FinishedAt.Valid {
+		resp.FinishedAt = job.FinishedAt.Time.UTC().Format(time.RFC3339)
+	}
+	if job.ExpiresAt.Valid {
+		resp.ExpiresAt = job.ExpiresAt.Time.UTC().Format(time.RFC3339)
+	}
+	if job.Status == services.ExportStatusDone {
+		resp.DownloadURL = fmt.Sprintf("/api/analytics/exports/%d/download", job.ID)
+	}
+	return resp
+}
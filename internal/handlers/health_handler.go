@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"github.com/sumanthd032/go-shorty/internal/database"
+	"github.com/sumanthd032/go-shorty/internal/services"
+)
+
+// HealthResponse reports dependency status along with connection pool and
+// click stream counters. The endpoint is public, so a failing dependency is
+// only reported as "unavailable"; the error itself goes to the server log.
+type HealthResponse struct {
+	Status      string               `json:"status"`
+	Database    string               `json:"database"`
+	Redis       string               `json:"redis"`
+	Pool        database.PoolStats   `json:"pool"`
+	ClickStream services.StreamStats `json:"click_stream"`
+}
+
+type HealthHandler struct {
+	pool      *pgxpool.Pool
+	cache     *redis.Client
+	publisher *services.ClickPublisher
+}
+
+func NewHealthHandler(pool *pgxpool.Pool, cache *redis.Client, publisher *services.ClickPublisher) *HealthHandler {
+	return &HealthHandler{pool: pool, cache: cache, publisher: publisher}
+}
+
+func (h *HealthHandler) GetHealth(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	resp := HealthResponse{
+		Status:   "ok",
+		Database: "ok",
+		Redis:    "ok",
+		Pool:     database.Stats(h.pool),
+		// Overflowing is reported but does not fail the check: redirects still work.
+		ClickStream: h.publisher.Stats(),
+	}
+	status := http.StatusOK
+
+	if err := h.pool.Ping(ctx); err != nil {
+		log.Printf("Health check: database unreachable: %v", err)
+		resp.Status, resp.Database = "degraded", "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+	if err := h.cache.Ping(ctx).Err(); err != nil {
+		log.Printf("Health check: redis unreachable: %v", err)
+		resp.Status, resp.Redis = "degraded", "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -3,8 +3,10 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"html/template"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -16,25 +18,56 @@ import (
 
 // LinkResponse defines the JSON structure for a link returned by the API.
 type LinkResponse struct {
-	ID          int64     `json:"id"`
-	Alias       string    `json:"alias"`
-	OriginalURL string    `json:"original_url"`
-	UserID      int64     `json:"user_id"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID                int64      `json:"id"`
+	Alias             string     `json:"alias"`
+	OriginalURL       string     `json:"original_url"`
+	UserID            int64      `json:"user_id"`
+	CreatedAt         time.Time  `json:"created_at"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	Expired           bool       `json:"expired"`
+	PasswordProtected bool       `json:"password_protected"`
+}
+
+func toLinkResponse(link db.Link) LinkResponse {
+	resp := LinkResponse{
+		ID:                link.ID,
+		Alias:             link.Alias,
+		OriginalURL:       link.OriginalUrl,
+		UserID:            link.UserID.Int64,
+		CreatedAt:         link.CreatedAt.Time,
+		Expired:           services.IsExpired(link),
+		PasswordProtected: len(link.PasswordHash) > 0,
+	}
+	if link.ExpiresAt.Valid {
+		expiresAt := link.ExpiresAt.Time
+		resp.ExpiresAt = &expiresAt
+	}
+	return resp
 }
 
 type LinkHandler struct {
-	service *services.LinkService
-	queries *db.Queries
+	service         *services.LinkService
+	queries         *db.Queries
+	expiredTemplate *template.Template
 }
 
-func NewLinkHandler(s *services.LinkService, queries *db.Queries) *LinkHandler {
-	return &LinkHandler{service: s, queries: queries}
+// NewLinkHandler creates a LinkHandler. expiredTemplate is rendered for expired
+// links; pass nil to use the built-in page (see ParseExpiredPage).
+func NewLinkHandler(s *services.LinkService, queries *db.Queries, expiredTemplate *template.Template) *LinkHandler {
+	if expiredTemplate == nil {
+		expiredTemplate = defaultExpiredTemplate
+	}
+	return &LinkHandler{service: s, queries: queries, expiredTemplate: expiredTemplate}
 }
 
+// CreateLinkRequest is the body of POST /api/links. Expiry is optional and can
+// be given either as an absolute ExpiresAt or as TTLSeconds from now, not both.
 type CreateLinkRequest struct {
-	URL   string `json:"url"`
-	Alias string `json:"alias,omitempty"`
+	URL        string     `json:"url"`
+	Alias      string     `json:"alias,omitempty"`
+	Password   string     `json:"password,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds int64      `json:"ttl_seconds,omitempty"`
 }
 
 func (h *LinkHandler) CreateLink(w http.ResponseWriter, r *http.Request) {
@@ -54,10 +87,18 @@ func (h *LinkHandler) CreateLink(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	expiresAt, ok := resolveExpiry(req.ExpiresAt, req.TTLSeconds)
+	if !ok {
+		http.Error(w, `{"error":"Provide either expires_at or a positive ttl_seconds, not both"}`, http.StatusBadRequest)
+		return
+	}
+
 	params := services.CreateLinkParams{
 		OriginalURL: req.URL,
 		CustomAlias: req.Alias,
 		UserID:      userID,
+		Password:    req.Password,
+		ExpiresAt:   expiresAt,
 	}
 
 	link, err := h.service.Create(r.Context(), params)
@@ -66,18 +107,20 @@ func (h *LinkHandler) CreateLink(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusConflict)
 			return
 		}
+		if errors.Is(err, services.ErrInvalidExpiry) || errors.Is(err, services.ErrInvalidAlias) {
+			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrLinkQuotaExceeded) {
+			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusForbidden)
+			return
+		}
 		log.Printf("Internal server error: %v", err)
 		http.Error(w, `{"error":"Could not create link"}`, http.StatusInternalServerError)
 		return
 	}
 
-	apiLink := LinkResponse{
-		ID:          link.ID,
-		Alias:       link.Alias,
-		OriginalURL: link.OriginalUrl,
-		UserID:      link.UserID.Int64,
-		CreatedAt:   link.CreatedAt.Time,
-	}
+	apiLink := toLinkResponse(link)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -91,12 +134,20 @@ func (h *LinkHandler) Redirect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	originalURL, err := h.service.GetOriginalURLAndTrack(r.Context(), alias, r.RemoteAddr, r.UserAgent(), r.Referer())
+	originalURL, err := h.service.GetOriginalURLAndTrack(r.Context(), alias, middleware.GetClientIP(r), r.UserAgent(), r.Referer())
 	if err != nil {
 		if errors.Is(err, services.ErrLinkNotFound) {
 			http.NotFound(w, r)
 			return
 		}
+		if errors.Is(err, services.ErrLinkExpired) {
+			h.renderExpiredPage(w, alias)
+			return
+		}
+		if errors.Is(err, services.ErrPasswordRequired) {
+			renderUnlockPage(w, http.StatusOK, unlockPageData{Alias: alias})
+			return
+		}
 		log.Printf("Internal server error on redirect: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -105,6 +156,70 @@ func (h *LinkHandler) Redirect(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, originalURL, http.StatusFound)
 }
 
+// Unlock handles the password form of a protected link and redirects on success.
+func (h *LinkHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+	alias := chi.URLParam(r, "alias")
+	if alias == "" {
+		http.Error(w, "Alias is missing", http.StatusBadRequest)
+		return
+	}
+
+	password := r.PostFormValue("password")
+	originalURL, err := h.service.UnlockAndTrack(r.Context(), alias, password, middleware.GetClientIP(r), r.UserAgent(), r.Referer())
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrLinkNotFound):
+			http.NotFound(w, r)
+		case errors.Is(err, services.ErrLinkExpired):
+			h.renderExpiredPage(w, alias)
+		case errors.Is(err, services.ErrInvalidPassword):
+			renderUnlockPage(w, http.StatusForbidden, unlockPageData{Alias: alias, Error: "Incorrect password."})
+		case errors.Is(err, services.ErrTooManyAttempts):
+			retryAfter := h.service.UnlockRetryAfter(r.Context(), alias)
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			renderUnlockPage(w, http.StatusTooManyRequests, unlockPageData{Alias: alias, Error: "Too many failed attempts. Please try again later."})
+		default:
+			log.Printf("Internal server error on unlock: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.Redirect(w, r, originalURL, http.StatusSeeOther)
+}
+
+// renderExpiredPage answers with 410 Gone so crawlers drop the link for good.
+func (h *LinkHandler) renderExpiredPage(w http.ResponseWriter, alias string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusGone)
+	if err := h.expiredTemplate.Execute(w, expiredPageData{Alias: alias}); err != nil {
+		log.Printf("Failed to render expired page: %v", err)
+	}
+}
+
+// resolveExpiry turns the optional expires_at / ttl_seconds pair into a single
+// expiry time. It returns false when both are set or the TTL is negative.
+func resolveExpiry(expiresAt *time.Time, ttlSeconds int64) (*time.Time, bool) {
+	if ttlSeconds < 0 || (expiresAt != nil && ttlSeconds != 0) {
+		return nil, false
+	}
+	if ttlSeconds > 0 {
+		t := time.Now().Add(time.Duration(ttlSeconds) * time.Second)
+		return &t, true
+	}
+	return expiresAt, true
+}
+
+func renderUnlockPage(w http.ResponseWriter, status int, data unlockPageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := unlockTemplate.Execute(w, data); err != nil {
+		log.Printf("Failed to render unlock page: %v", err)
+	}
+}
+
 func (h *LinkHandler) GetUserLinks(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
 	if !ok {
@@ -120,16 +235,135 @@ func (h *LinkHandler) GetUserLinks(w http.ResponseWriter, r *http.Request) {
 
 	apiLinks := make([]LinkResponse, 0, len(dbLinks))
 	for _, link := range dbLinks {
-		apiLinks = append(apiLinks, LinkResponse{
-			ID:          link.ID,
-			Alias:       link.Alias,
-			OriginalURL: link.OriginalUrl,
-			UserID:      link.UserID.Int64,
-			CreatedAt:   link.CreatedAt.Time,
-		})
+		apiLinks = append(apiLinks, toLinkResponse(link))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(apiLinks)
-}
\ No newline at end of file
+}
+
+// UpdateLinkRequest is the body of PATCH /api/links/{id}. Omitted fields are
+// left unchanged. An empty password removes the password, and clear_expiry
+// removes the expiry.
+type UpdateLinkRequest struct {
+	URL         *string    `json:"url,omitempty"`
+	Alias       *string    `json:"alias,omitempty"`
+	Password    *string    `json:"password,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds  int64      `json:"ttl_seconds,omitempty"`
+	ClearExpiry bool       `json:"clear_expiry,omitempty"`
+}
+
+func (h *LinkHandler) GetLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not authenticated"}`, http.StatusInternalServerError)
+		return
+	}
+
+	linkID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid link ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	link, err := h.service.Get(r.Context(), linkID, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrLinkNotFound) {
+			http.Error(w, `{"error":"Link not found"}`, http.StatusNotFound)
+			return
+		}
+		log.Printf("Internal server error: %v", err)
+		http.Error(w, `{"error":"Could not fetch link"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toLinkResponse(link))
+}
+
+func (h *LinkHandler) UpdateLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not authenticated"}`, http.StatusInternalServerError)
+		return
+	}
+
+	linkID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid link ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if req.URL != nil && *req.URL == "" {
+		http.Error(w, `{"error":"URL cannot be empty"}`, http.StatusBadRequest)
+		return
+	}
+
+	expiresAt, ok := resolveExpiry(req.ExpiresAt, req.TTLSeconds)
+	if !ok || (req.ClearExpiry && expiresAt != nil) {
+		http.Error(w, `{"error":"Provide one of expires_at, a positive ttl_seconds or clear_expiry"}`, http.StatusBadRequest)
+		return
+	}
+
+	params := services.UpdateLinkParams{
+		OriginalURL: req.URL,
+		Alias:       req.Alias,
+		ExpiresAt:   expiresAt,
+		ClearExpiry: req.ClearExpiry,
+		Password:    req.Password,
+	}
+
+	link, err := h.service.Update(r.Context(), linkID, userID, params)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrLinkNotFound):
+			http.Error(w, `{"error":"Link not found"}`, http.StatusNotFound)
+		case errors.Is(err, services.ErrAliasExists):
+			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusConflict)
+		case errors.Is(err, services.ErrInvalidExpiry), errors.Is(err, services.ErrInvalidAlias):
+			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		default:
+			log.Printf("Internal server error: %v", err)
+			http.Error(w, `{"error":"Could not update link"}`, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toLinkResponse(link))
+}
+
+func (h *LinkHandler) DeleteLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not authenticated"}`, http.StatusInternalServerError)
+		return
+	}
+
+	linkID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid link ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), linkID, userID); err != nil {
+		if errors.Is(err, services.ErrLinkNotFound) {
+			http.Error(w, `{"error":"Link not found"}`, http.StatusNotFound)
+			return
+		}
+		log.Printf("Internal server error: %v", err)
+		http.Error(w, `{"error":"Could not delete link"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sumanthd032/go-shorty/internal/middleware"
+	"github.com/sumanthd032/go-shorty/internal/repositories/db"
+	"github.com/sumanthd032/go-shorty/internal/services"
+)
+
+// liveRetryMillis is the reconnect delay suggested to EventSource clients.
+const liveRetryMillis = 3000
+
+type LiveHandler struct {
+	queries *db.Queries
+	feed    *services.LiveFeed
+	// shutdown is closed when the server stops so open streams end and
+	// clients reconnect elsewhere instead of holding up the shutdown.
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+}
+
+func NewLiveHandler(queries *db.Queries, feed *services.LiveFeed) *LiveHandler {
+	return &LiveHandler{queries: queries, feed: feed, shutdown: make(chan struct{})}
+}
+
+// Close ends all open streams after their current read. Register it with
+// http.Server.RegisterOnShutdown.
+func (h *LiveHandler) Close() {
+	h.shutdownOnce.Do(func() { close(h.shutdown) })
+}
+
+// StreamClicks pushes the link's clicks as Server-Sent Events as soon as the
+// worker has stored them.
+//
+//	GET /api/links/{id}/live
+//
+// Each click is a "click" event whose ID is its Redis stream ID. Clients that
+// reconnect with Last-Event-ID (or ?last_event_id=) receive the clicks they
+// missed, as far back as the live stream reaches. Idle connections get a
+// comment every heartbeat. The server must not set a WriteTimeout, which
+// would cut these responses off.
+func (h *LiveHandler) StreamClicks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not authenticated"}`, http.StatusInternalServerError)
+		return
+	}
+
+	linkID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid link ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	if lastID != "" && !services.ValidLiveEventID(lastID) {
+		http.Error(w, `{"error":"Invalid Last-Event-ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.queries.GetLinkByIDForUser(r.Context(), db.GetLinkByIDForUserParams{
+		ID:     linkID,
+		UserID: pgtype.Int8{Int64: userID, Valid: true},
+	}); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, `{"error":"Link not found"}`, http.StatusNotFound)
+			return
+		}
+		http.Error(w, `{"error":"Could not fetch link"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if lastID == "" {
+		lastID, err = h.feed.LastID(r.Context(), linkID)
+		if err != nil {
+			log.Printf("Failed to read live stream of link %d: %v", linkID, err)
+			http.Error(w, `{"error":"Live feed unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	sub, err := h.feed.Subscribe(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, services.ErrTooManySubscribers) {
+			http.Error(w, `{"error":"Too many live connections"}`, http.StatusTooManyRequests)
+			return
+		}
+		log.Printf("Failed to subscribe user %d to live feed: %v", userID, err)
+		http.Error(w, `{"error":"Live feed unavailable"}`, http.StatusServiceUnavailable)
+		return
+	}
+	defer sub.Release(context.WithoutCancel(r.Context()))
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Connection", "keep-alive")
+	// Stop nginx and similar proxies from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", liveRetryMillis)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-h.shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for ctx.Err() == nil {
+		events, err := h.feed.Read(ctx, linkID, lastID)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to read live stream of link %d: %v", linkID, err)
+			}
+			return
+		}
+
+		if err := sub.KeepAlive(ctx); err != nil {
+			return
+		}
+		if len(events) == 0 {
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		for _, event := range events {
+			data, err := json.Marshal(event.Click)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %s\nevent: click\ndata: %s\n\n", event.ID, data)
+			lastID = event.ID
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
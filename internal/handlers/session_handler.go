@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sumanthd032/go-shorty/internal/middleware"
+	"github.com/sumanthd032/go-shorty/internal/services"
+	"github.com/sumanthd032/go-shorty/pkg/useragent"
+)
+
+type SessionHandler struct {
+	store *services.SessionStore
+}
+
+func NewSessionHandler(store *services.SessionStore) *SessionHandler {
+	return &SessionHandler{store: store}
+}
+
+type SessionResponse struct {
+	ID string `json:"id"`
+	// Current marks the session the request was made with.
+	Current    bool   `json:"current"`
+	IP         string `json:"ip"`
+	UserAgent  string `json:"user_agent"`
+	Browser    string `json:"browser"`
+	OS         string `json:"os"`
+	Device     string `json:"device"`
+	CreatedAt  string `json:"created_at"`
+	LastSeenAt string `json:"last_seen_at"`
+	ExpiresAt  string `json:"expires_at"`
+}
+
+// ListSessions returns the user's active login sessions, most recently used
+// first.
+//
+//	GET /api/users/me/sessions
+func (h *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not found in context"}`, http.StatusInternalServerError)
+		return
+	}
+
+	sessions, err := h.store.List(r.Context(), userID)
+	if err != nil {
+		http.Error(w, `{"error":"Could not fetch sessions"}`, http.StatusInternalServerError)
+		return
+	}
+
+	current := h.currentSessionID(r)
+	resp := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		ua := useragent.Parse(session.UserAgent)
+		resp = append(resp, SessionResponse{
+			ID:         session.ID,
+			Current:    session.ID == current,
+			IP:         session.IP,
+			UserAgent:  session.UserAgent,
+			Browser:    ua.Browser,
+			OS:         ua.OS,
+			Device:     ua.Device,
+			CreatedAt:  session.CreatedAt.UTC().Format(time.RFC3339),
+			LastSeenAt: session.LastSeen.UTC().Format(time.RFC3339),
+			ExpiresAt:  session.ExpiresAt.UTC().Format(time.RFC3339),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RevokeSession ends one of the user's sessions. Revoking the current one
+// logs the caller out.
+//
+//	DELETE /api/users/me/sessions/{id}
+func (h *SessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not found in context"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.store.Revoke(r.Context(), userID, chi.URLParam(r, "id")); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			http.Error(w, `{"error":"Session not found"}`, http.StatusNotFound)
+			return
+		}
+		http.Error(w, `{"error":"Could not revoke session"}`, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeOtherSessions ends all of the user's sessions except the current one.
+//
+//	DELETE /api/users/me/sessions
+func (h *SessionHandler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not found in context"}`, http.StatusInternalServerError)
+		return
+	}
+
+	revoked, err := h.store.RevokeAll(r.Context(), userID, h.currentSessionID(r))
+	if err != nil {
+		http.Error(w, `{"error":"Could not revoke sessions"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]int{"revoked": revoked})
+}
+
+// currentSessionID returns the ID of the session the request was made with.
+func (h *SessionHandler) currentSessionID(r *http.Request) string {
+	session, err := h.store.Get(r, "auth-session")
+	if err != nil {
+		return ""
+	}
+	return services.CurrentSessionID(session)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import "html/template"
+
+// unlockPageData is rendered into unlockTemplate.
+type unlockPageData struct {
+	Alias string
+	Error string
+}
+
+// unlockTemplate is the form shown to visitors of a password protected link.
+// It posts back to the same alias so the redirect only happens once the
+// password has been checked on the server.
+var unlockTemplate = template.Must(template.New("unlock").Parse(`<!DOCTYPE html>
+<html lang="en" class="h-full bg-gray-50">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="robots" content="noindex">
+    <title>Protected Link - Shorty</title>
+    <script src="https://cdn.tailwindcss.com"></script>
+</head>
+<body class="h-full">
+    <div class="flex min-h-full flex-col justify-center px-6 py-12 lg:px-8">
+        <div class="sm:mx-auto sm:w-full sm:max-w-sm">
+            <h2 class="mt-10 text-center text-3xl font-bold leading-9 tracking-tight text-indigo-600">Shorty</h2>
+            <h3 class="mt-2 text-center text-xl font-medium text-gray-800">This link is password protected</h3>
+        </div>
+
+        <div class="mt-10 sm:mx-auto sm:w-full sm:max-w-sm">
+            <form method="POST" action="/{{.Alias}}" class="space-y-6">
+                <div>
+                    <label for="password" class="block text-sm font-medium leading-6 text-gray-900">Password</label>
+                    <div class="mt-2">
+                        <input id="password" name="password" type="password" autocomplete="off" required autofocus class="block w-full rounded-md border-0 py-1.5 text-gray-900 shadow-sm ring-1 ring-inset ring-gray-300 focus:ring-2 focus:ring-inset focus:ring-indigo-600 sm:text-sm sm:leading-6 p-2">
+                    </div>
+                </div>
+
+                {{if .Error}}<p class="text-sm text-red-600">{{.Error}}</p>{{end}}
+
+                <div>
+                    <button type="submit" class="flex w-full justify-center rounded-md bg-indigo-600 px-3 py-1.5 text-sm font-semibold leading-6 text-white shadow-sm hover:bg-indigo-500">Continue</button>
+                </div>
+            </form>
+        </div>
+    </div>
+</body>
+</html>`))
+
+// expiredPageData is rendered into the expired link template.
+type expiredPageData struct {
+	Alias string
+}
+
+var defaultExpiredTemplate = template.Must(template.New("expired").Parse(`<!DOCTYPE html>
+<html lang="en" class="h-full bg-gray-50">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="robots" content="noindex">
+    <title>Link Expired - Shorty</title>
+    <script src="https://cdn.tailwindcss.com"></script>
+</head>
+<body class="h-full">
+    <div class="flex min-h-full flex-col justify-center px-6 py-12 lg:px-8">
+        <div class="sm:mx-auto sm:w-full sm:max-w-sm text-center">
+            <h2 class="mt-10 text-3xl font-bold leading-9 tracking-tight text-indigo-600">Shorty</h2>
+            <h3 class="mt-2 text-xl font-medium text-gray-800">This link has expired</h3>
+            <p class="mt-4 text-sm text-gray-500">The short link <span class="font-mono">/{{.Alias}}</span> is no longer active.</p>
+        </div>
+    </div>
+</body>
+</html>`))
+
+// ParseExpiredPage loads a custom template for expired links from path. An
+// empty path returns the built-in page. The template receives .Alias.
+func ParseExpiredPage(path string) (*template.Template, error) {
+	if path == "" {
+		return defaultExpiredTemplate, nil
+	}
+	return template.ParseFiles(path)
+}
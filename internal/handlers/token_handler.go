@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sumanthd032/go-shorty/internal/middleware"
+	"github.com/sumanthd032/go-shorty/internal/repositories/db"
+	"github.com/sumanthd032/go-shorty/internal/services"
+)
+
+type TokenHandler struct {
+	service *services.APITokenService
+}
+
+func NewTokenHandler(service *services.APITokenService) *TokenHandler {
+	return &TokenHandler{service: service}
+}
+
+// CreateTokenRequest names a new API token and lists its scopes. ExpiresAt is
+// optional; without it the token stays valid until revoked.
+type CreateTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type TokenResponse struct {
+	ID     int64    `json:"id"`
+	Name   string   `json:"name"`
+	Prefix string   `json:"prefix"`
+	Scopes []string `json:"scopes"`
+	// Token is only set in the response that creates it.
+	Token      string  `json:"token,omitempty"`
+	CreatedAt  string  `json:"created_at"`
+	LastUsedAt *string `json:"last_used_at"`
+	ExpiresAt  *string `json:"expires_at"`
+}
+
+// CreateToken issues a personal API token. The token itself is only returned
+// here and cannot be retrieved again.
+//
+//	POST /api/users/me/tokens
+func (h *TokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not found in context"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var req CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	var expiresAt time.Time
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+
+	token, record, err := h.service.Create(r.Context(), userID, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidTokenName) || errors.Is(err, services.ErrInvalidScope) || errors.Is(err, services.ErrInvalidTokenExpiry) {
+			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+			return
+		}
+		http.Error(w, `{"error":"Could not create token"}`, http.StatusInternalServerError)
+		return
+	}
+
+	resp := tokenResponse(record)
+	resp.Token = token
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ListTokens returns the user's API tokens without their secrets.
+//
+//	GET /api/users/me/tokens
+func (h *TokenHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not found in context"}`, http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := h.service.List(r.Context(), userID)
+	if err != nil {
+		http.Error(w, `{"error":"Could not fetch tokens"}`, http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]TokenResponse, 0, len(tokens))
+	for _, token := range tokens {
+		resp = append(resp, tokenResponse(token))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RevokeToken deletes one of the user's API tokens.
+//
+//	DELETE /api/users/me/tokens/{id}
+func (h *TokenHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not found in context"}`, http.StatusInternalServerError)
+		return
+	}
+
+	tokenID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid token ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.Revoke(r.Context(), userID, tokenID); err != nil {
+		if errors.Is(err, services.ErrAPITokenNotFound) {
+			http.Error(w, `{"error":"Token not found"}`, http.StatusNotFound)
+			return
+		}
+		http.Error(w, `{"error":"Could not revoke token"}`, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func tokenResponse(token db.ApiToken) TokenResponse {
+	resp := TokenResponse{
+		ID:        token.ID,
+		Name:      token.Name,
+		Prefix:    token.Prefix,
+		Scopes:    token.Scopes,
+		CreatedAt: token.CreatedAt.Time.UTC().Format(time.RFC3339),
+	}
+	if token.LastUsedAt.Valid {
+		lastUsed := token.LastUsedAt.Time.UTC().Format(time.RFC3339)
+		resp.LastUsedAt = &lastUsed
+	}
+	if token.ExpiresAt.Valid {
+		expires := token.ExpiresAt.Time.UTC().Format(time.RFC3339)
+		resp.ExpiresAt = &expires
+	}
+	return resp
+}
@@ -3,7 +3,10 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/sessions"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -28,8 +31,9 @@ type UserRequest struct {
 }
 
 type UserResponse struct {
-	ID    int64  `json:"id"`
-	Email string `json:"email"`
+	ID            int64  `json:"id"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
 }
 
 func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
@@ -39,8 +43,11 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.service.Register(r.Context(), req.Email, req.Password)
+	user, err := h.service.Register(r.Context(), middleware.GetClientIP(r), req.Email, req.Password)
 	if err != nil {
+		if writeRateLimited(w, err) {
+			return
+		}
 		// --- FIX: Check for a specific database error ---
 		var pgErr *pgconn.PgError
 		// Error code '23505' is for unique_violation in PostgreSQL.
@@ -55,7 +62,7 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userResp := UserResponse{ID: user.ID, Email: user.Email}
+	userResp := UserResponse{ID: user.ID, Email: user.Email, EmailVerified: services.IsVerified(user)}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(userResp)
@@ -68,9 +75,17 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.service.Login(r.Context(), req.Email, req.Password)
+	user, err := h.service.Login(r.Context(), middleware.GetClientIP(r), req.Email, req.Password)
 	if err != nil {
-		http.Error(w, `{"error":"Invalid credentials"}`, http.StatusUnauthorized)
+		if writeRateLimited(w, err) {
+			return
+		}
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			http.Error(w, `{"error":"Invalid credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		log.Printf("Login failed: %v", err)
+		http.Error(w, `{"error":"Could not log in"}`, http.StatusInternalServerError)
 		return
 	}
 
@@ -86,6 +101,19 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"message": "Logged in successfully"})
 }
 
+// writeRateLimited answers a *services.RateLimitError with 429 and
+// Retry-After. It reports whether err was one.
+func writeRateLimited(w http.ResponseWriter, err error) bool {
+	var limitErr *services.RateLimitError
+	if !errors.As(err, &limitErr) {
+		return false
+	}
+	retryAfter := int(math.Ceil(limitErr.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	http.Error(w, `{"error":"`+limitErr.Error()+`"}`, http.StatusTooManyRequests)
+	return true
+}
+
 func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	session, _ := h.sessionStore.Get(r, "auth-session")
 	session.Options.MaxAge = -1
@@ -110,8 +138,246 @@ func (h *UserHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userResp := UserResponse{ID: user.ID, Email: user.Email}
+	userResp := UserResponse{ID: user.ID, Email: user.Email, EmailVerified: services.IsVerified(user)}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(userResp)
-}
\ No newline at end of file
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ChangePassword sets a new password. All of the user's sessions end,
+// including this one, which is replaced by a fresh session so the caller
+// stays logged in.
+//
+//	PUT /api/users/me/password
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not found in context"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.ChangePassword(r.Context(), middleware.GetClientIP(r), userID, req.CurrentPassword, req.NewPassword); err != nil {
+		if writeRateLimited(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, services.ErrIncorrectPassword):
+			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusForbidden)
+		case errors.Is(err, services.ErrWeakPassword):
+			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		default:
+			http.Error(w, `{"error":"Could not change password"}`, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	session, _ := h.sessionStore.Get(r, "auth-session")
+	session.Values["user_id"] = userID
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, `{"error":"Could not save session"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password changed"})
+}
+
+type TokenRequest struct {
+	Token string `json:"token"`
+}
+
+// VerifyEmail verifies the user's email with the token from a verification
+// email.
+//
+//	POST /api/users/verify
+func (h *UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req TokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.VerifyEmail(r.Context(), req.Token); err != nil {
+		if errors.Is(err, services.ErrInvalidAccountToken) {
+			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+			return
+		}
+		log.Printf("Email verification failed: %v", err)
+		http.Error(w, `{"error":"Could not verify email"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified"})
+}
+
+// ResendVerification emails the logged-in user a new verification link.
+//
+//	POST /api/users/verify/resend
+func (h *UserHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not found in context"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.service.ResendVerification(r.Context(), middleware.GetClientIP(r), userID); err != nil {
+		if writeRateLimited(w, err) {
+			return
+		}
+		if errors.Is(err, services.ErrAlreadyVerified) {
+			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusConflict)
+			return
+		}
+		log.Printf("Resending verification failed: %v", err)
+		http.Error(w, `{"error":"Could not send verification email"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"})
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ForgotPassword emails a password reset link. The response is the same
+// whether or not the email has an account.
+//
+//	POST /api/users/password/forgot
+func (h *UserHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.RequestPasswordReset(r.Context(), middleware.GetClientIP(r), req.Email); err != nil {
+		if writeRateLimited(w, err) {
+			return
+		}
+		log.Printf("Password reset request failed: %v", err)
+		http.Error(w, `{"error":"Could not request password reset"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "If the email has an account, a reset link has been sent"})
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ResetPassword sets a new password with the token from a reset email. All
+// of the user's sessions end; they log in again with the new password.
+//
+//	POST /api/users/password/reset
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.ResetPassword(r.Context(), req.Token, req.Password); err != nil {
+		if errors.Is(err, services.ErrInvalidAccountToken) || errors.Is(err, services.ErrWeakPassword) {
+			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+			return
+		}
+		log.Printf("Password reset failed: %v", err)
+		http.Error(w, `{"error":"Could not reset password"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password reset"})
+}
+
+// PrivacyRequest sets the user's IP mode. A null or missing ip_mode restores
+// the deployment default.
+type PrivacyRequest struct {
+	IPMode *string `json:"ip_mode"`
+}
+
+type PrivacyResponse struct {
+	// IPMode is the user's own choice, null when the default applies.
+	IPMode          *string `json:"ip_mode"`
+	EffectiveIPMode string  `json:"effective_ip_mode"`
+}
+
+func (h *UserHandler) GetPrivacy(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not found in context"}`, http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.queries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, `{"error":"User not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.privacyResponse(user))
+}
+
+func (h *UserHandler) UpdatePrivacy(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, `{"error":"User not found in context"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var req PrivacyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	mode := ""
+	if req.IPMode != nil {
+		mode = *req.IPMode
+	}
+
+	user, err := h.service.SetIPMode(r.Context(), userID, mode)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidIPMode) {
+			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+			return
+		}
+		http.Error(w, `{"error":"Could not update privacy settings"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.privacyResponse(user))
+}
+
+func (h *UserHandler) privacyResponse(user db.User) PrivacyResponse {
+	resp := PrivacyResponse{EffectiveIPMode: h.service.EffectiveIPMode(user)}
+	if user.IpMode.Valid {
+		resp.IPMode = &user.IpMode.String
+	}
+	return resp
+}
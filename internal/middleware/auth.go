@@ -2,23 +2,62 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/sessions"
+	"github.com/sumanthd032/go-shorty/internal/services"
 )
 
 type contextKey string
 
 const UserIDKey contextKey = "userID"
 
-func Auth(store sessions.Store) func(http.Handler) http.Handler {
+// TokenScopesKey holds the scopes of the API token a request was
+// authenticated with. It is absent for session logins, which may do anything.
+const TokenScopesKey contextKey = "tokenScopes"
+
+// Auth accepts either a personal API token in an "Authorization: Bearer"
+// header or the auth-session cookie. Unauthenticated browser navigations are
+// redirected to the login page; anything else gets a JSON 401.
+func Auth(store sessions.Store, tokens *services.APITokenService) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			session, _ := store.Get(r, "auth-session")
+			if token, ok := bearerToken(r); ok {
+				userID, scopes, err := tokens.Authenticate(r.Context(), token)
+				if err != nil {
+					if !errors.Is(err, services.ErrInvalidToken) {
+						log.Printf("Failed to authenticate API token: %v", err)
+						http.Error(w, `{"error":"Could not authenticate"}`, http.StatusInternalServerError)
+						return
+					}
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					http.Error(w, `{"error":"Invalid or expired token"}`, http.StatusUnauthorized)
+					return
+				}
+				ctx := context.WithValue(r.Context(), UserIDKey, userID)
+				ctx = context.WithValue(ctx, TokenScopesKey, scopes)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			session, err := store.Get(r, "auth-session")
+			if err != nil {
+				log.Printf("Failed to load session: %v", err)
+				http.Error(w, `{"error":"Could not authenticate"}`, http.StatusInternalServerError)
+				return
+			}
 			userID, ok := session.Values["user_id"].(int64)
 
 			if !ok || userID == 0 {
-				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				unauthorized(w, r)
 				return
 			}
 
@@ -26,4 +65,85 @@ func Auth(store sessions.Store) func(http.Handler) http.Handler {
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
+}
+
+// RequireScope rejects requests authenticated with an API token that lacks
+// scope. Session logins always pass.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, isToken := r.Context().Value(TokenScopesKey).([]string)
+			if isToken && !slices.Contains(scopes, scope) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+				http.Error(w, `{"error":"Token lacks the `+scope+` scope"}`, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SessionOnly rejects requests authenticated with an API token, for account
+// settings such as the tokens themselves.
+func SessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, isToken := r.Context().Value(TokenScopesKey).([]string); isToken {
+			http.Error(w, `{"error":"Not available to API tokens"}`, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// unauthorized answers a request that carries no credentials. A browser
+// loading a page is sent to the login page with a next parameter to return it
+// to; fetch() calls and API clients get a 401 they can handle.
+func unauthorized(w http.ResponseWriter, r *http.Request) {
+	if isNavigation(r) {
+		target := "/login"
+		if r.Method == http.MethodGet {
+			target += "?next=" + url.QueryEscape(r.URL.RequestURI())
+		}
+		http.Redirect(w, r, target, http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("WWW-Authenticate", `Bearer realm="go-shorty"`)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{"error": "Authentication required"})
+}
+
+// isNavigation reports whether r is a browser loading a page rather than a
+// script or API client. Browsers that send Sec-Fetch-Mode say so directly;
+// otherwise a request that accepts HTML counts as a navigation, since fetch()
+// sends "*/*" by default.
+func isNavigation(r *http.Request) bool {
+	if mode := r.Header.Get("Sec-Fetch-Mode"); mode != "" {
+		return mode == "navigate"
+	}
+	if r.Header.Get("X-Requested-With") != "" {
+		return false
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(accept)
+		if err != nil || mediaType != "text/html" {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
 }
\ No newline at end of file
@@ -0,0 +1,251 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		cidrs   []string
+		want    []string
+		wantErr bool
+	}{
+		{"empty", nil, []string{}, false},
+		{"blank entries skipped", []string{"", "  "}, []string{}, false},
+		{"IPv4 CIDR", []string{"10.0.0.0/8"}, []string{"10.0.0.0/8"}, false},
+		{"host bits masked", []string{"192.168.1.7/24"}, []string{"192.168.1.0/24"}, false},
+		{"bare IPv4", []string{" 203.0.113.5 "}, []string{"203.0.113.5/32"}, false},
+		{"bare IPv6", []string{"2001:db8::1"}, []string{"2001:db8::1/128"}, false},
+		{"IPv6 CIDR", []string{"2001:db8::/32"}, []string{"2001:db8::/32"}, false},
+		{"bare IPv4-mapped IPv6", []string{"::ffff:10.1.2.3"}, []string{"10.1.2.3/32"}, false},
+		{"IPv4-mapped IPv6 CIDR", []string{"::ffff:10.0.0.0/104"}, []string{"10.0.0.0/8"}, false},
+		{"IPv4-mapped IPv6 /96", []string{"::ffff:0.0.0.0/96"}, []string{"0.0.0.0/0"}, false},
+		{"IPv4-mapped IPv6 shorter than /96", []string{"::ffff:0.0.0.0/80"}, nil, true},
+		{"invalid address", []string{"proxy.internal"}, nil, true},
+		{"invalid CIDR", []string{"10.0.0.0/33"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTrustedProxies(tt.cidrs)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseTrustedProxies(%q) = %v, want error", tt.cidrs, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTrustedProxies(%q): %v", tt.cidrs, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseTrustedProxies(%q) = %v, want %v", tt.cidrs, got, tt.want)
+			}
+			for i := range got {
+				if got[i].String() != tt.want[i] {
+					t.Errorf("ParseTrustedProxies(%q)[%d] = %v, want %v", tt.cidrs, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "::ffff:172.16.0.0/108", "2001:db8:ffff::/48"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string][]string
+		want       string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "198.51.100.7:51234",
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "headers from an untrusted peer are ignored",
+			remoteAddr: "198.51.100.7:51234",
+			headers:    map[string][]string{"X-Forwarded-For": {"203.0.113.1"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "direct IPv6 client",
+			remoteAddr: "[2001:db8::1]:443",
+			want:       "2001:db8::1",
+		},
+		{
+			name:       "IPv4-mapped peer is unmapped",
+			remoteAddr: "[::ffff:198.51.100.7]:443",
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "trusted proxy without headers",
+			remoteAddr: "10.0.0.2:80",
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "X-Forwarded-For",
+			remoteAddr: "10.0.0.2:80",
+			headers:    map[string][]string{"X-Forwarded-For": {"203.0.113.1"}},
+			want:       "203.0.113.1",
+		},
+		{
+			name:       "spoofed X-Forwarded-For entry before the real client",
+			remoteAddr: "10.0.0.2:80",
+			headers:    map[string][]string{"X-Forwarded-For": {"1.2.3.4, 203.0.113.1"}},
+			want:       "203.0.113.1",
+		},
+		{
+			name:       "chain of trusted proxies",
+			remoteAddr: "10.0.0.2:80",
+			headers:    map[string][]string{"X-Forwarded-For": {"203.0.113.1, 10.0.0.9, 10.0.0.8"}},
+			want:       "203.0.113.1",
+		},
+		{
+			name:       "X-Forwarded-For split over several headers",
+			remoteAddr: "10.0.0.2:80",
+			headers:    map[string][]string{"X-Forwarded-For": {"1.2.3.4", "203.0.113.1, 10.0.0.9"}},
+			want:       "203.0.113.1",
+		},
+		{
+			name:       "only trusted hops",
+			remoteAddr: "10.0.0.2:80",
+			headers:    map[string][]string{"X-Forwarded-For": {"10.0.0.9"}},
+			want:       "10.0.0.9",
+		},
+		{
+			name:       "unknown hop ends the chain",
+			remoteAddr: "10.0.0.2:80",
+			headers:    map[string][]string{"X-Forwarded-For": {"203.0.113.1, unknown, 10.0.0.9"}},
+			want:       "10.0.0.9",
+		},
+		{
+			name:       "X-Forwarded-For with port",
+			remoteAddr: "10.0.0.2:80",
+			headers:    map[string][]string{"X-Forwarded-For": {"203.0.113.1:4711"}},
+			want:       "203.0.113.1",
+		},
+		{
+			name:       "Forwarded",
+			remoteAddr: "10.0.0.2:80",
+			headers:    map[string][]string{"Forwarded": {"for=203.0.113.1;proto=https;by=10.0.0.2"}},
+			want:       "203.0.113.1",
+		},
+		{
+			name:       "Forwarded with quoted IPv6 and port",
+			remoteAddr: "10.0.0.2:80",
+			headers:    map[string][]string{"Forwarded": {`for="[2001:db8:cafe::17]:4711"`}},
+			want:       "2001:db8:cafe::17",
+		},
+		{
+			name:       "Forwarded chain with upper-case key",
+			remoteAddr: "10.0.0.2:80",
+			headers:    map[string][]string{"Forwarded": {"for=1.2.3.4, For=203.0.113.1, for=10.0.0.9"}},
+			want:       "203.0.113.1",
+		},
+		{
+			name:       "Forwarded with obfuscated hop",
+			remoteAddr: "10.0.0.2:80",
+			headers:    map[string][]string{"Forwarded": {"for=203.0.113.1, for=_hidden"}},
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "Forwarded takes precedence",
+			remoteAddr: "10.0.0.2:80",
+			headers: map[string][]string{
+				"Forwarded":       {"for=203.0.113.1"},
+				"X-Forwarded-For": {"203.0.113.2"},
+				"X-Real-Ip":       {"203.0.113.3"},
+			},
+			want: "203.0.113.1",
+		},
+		{
+			name:       "X-Real-IP",
+			remoteAddr: "10.0.0.2:80",
+			headers:    map[string][]string{"X-Real-Ip": {"203.0.113.3"}},
+			want:       "203.0.113.3",
+		},
+		{
+			name:       "IPv4-mapped peer in an IPv4-mapped trusted range",
+			remoteAddr: "[::ffff:172.16.0.5]:80",
+			headers:    map[string][]string{"X-Forwarded-For": {"203.0.113.1"}},
+			want:       "203.0.113.1",
+		},
+		{
+			name:       "IPv4 peer in an IPv4-mapped trusted range",
+			remoteAddr: "172.16.0.5:80",
+			headers:    map[string][]string{"X-Forwarded-For": {"::ffff:203.0.113.1"}},
+			want:       "203.0.113.1",
+		},
+		{
+			name:       "IPv6 trusted proxy",
+			remoteAddr: "[2001:db8:ffff::2]:80",
+			headers:    map[string][]string{"X-Forwarded-For": {"2001:db8::1"}},
+			want:       "2001:db8::1",
+		},
+		{
+			name:       "zoned IPv6 hop",
+			remoteAddr: "10.0.0.2:80",
+			headers:    map[string][]string{"X-Forwarded-For": {"fe80::1%eth0"}},
+			want:       "fe80::1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := ClientIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = GetClientIP(r)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for key, values := range tt.headers {
+				for _, value := range values {
+					r.Header.Add(key, value)
+				}
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			if got != tt.want {
+				t.Errorf("client IP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetClientIPWithoutMiddleware(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "[::ffff:198.51.100.7]:443"
+	if got := GetClientIP(r); got != "198.51.100.7" {
+		t.Errorf("GetClientIP = %q, want %q", got, "198.51.100.7")
+	}
+}
+
+func TestParseIP(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"203.0.113.1", "203.0.113.1", true},
+		{" 203.0.113.1:8080 ", "203.0.113.1", true},
+		{`"203.0.113.1"`, "203.0.113.1", true},
+		{"[2001:db8::1]", "2001:db8::1", true},
+		{"[2001:db8::1]:443", "2001:db8::1", true},
+		{"::ffff:203.0.113.1", "203.0.113.1", true},
+		{"unknown", "", false},
+		{"_hidden", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		addr, ok := parseIP(tt.in)
+		if ok != tt.ok || (ok && addr != netip.MustParseAddr(tt.want)) {
+			t.Errorf("parseIP(%q) = %v, %v; want %s, %v", tt.in, addr, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -20,7 +20,7 @@ INSERT INTO clicks (
 ) VALUES (
     $1, $2, $3, $4
 )
-RETURNING id, link_id, clicked_at, ip_address, user_agent, referrer
+RETURNING id, link_id, clicked_at, ip_address, user_agent, referrer, browser, os, device_type, referrer_domain, country, region, city, is_bot, bot_name, is_preview
 `
 
 type CreateClickParams struct {
@@ -45,37 +45,172 @@ func (q *Queries) CreateClick(ctx context.Context, arg CreateClickParams) (Click
 		&i.IpAddress,
 		&i.UserAgent,
 		&i.Referrer,
+		&i.Browser,
+		&i.Os,
+		&i.DeviceType,
+		&i.ReferrerDomain,
+		&i.Country,
+		&i.Region,
+		&i.City,
+		&i.IsBot,
+		&i.BotName,
+		&i.IsPreview,
 	)
 	return i, err
 }
 
+type CreateClicksParams struct {
+	LinkID         int64
+	ClickedAt      pgtype.Timestamptz
+	IpAddress      pgtype.Text
+	UserAgent      pgtype.Text
+	Referrer       pgtype.Text
+	Browser        pgtype.Text
+	Os             pgtype.Text
+	DeviceType     pgtype.Text
+	ReferrerDomain pgtype.Text
+	Country        pgtype.Text
+	Region         pgtype.Text
+	City           pgtype.Text
+	IsBot          bool
+	BotName        pgtype.Text
+	IsPreview      bool
+}
+
+const exportClicks = `-- name: ExportClicks :many
+SELECT
+    c.link_id,
+    l.alias,
+    c.clicked_at,
+    c.ip_address,
+    c.user_agent,
+    c.referrer,
+    c.referrer_domain,
+    c.browser,
+    c.os,
+    c.device_type,
+    c.country,
+    c.region,
+    c.city,
+    c.is_bot,
+    c.bot_name,
+    c.is_preview
+FROM clicks c
+JOIN links l ON l.id = c.link_id
+WHERE l.user_id = $1
+    AND ($2::bigint IS NULL OR c.link_id = $2::bigint)
+    AND c.clicked_at >= $3::timestamptz
+    AND c.clicked_at < $4::timestamptz
+ORDER BY c.clicked_at, c.id
+`
+
+type ExportClicksParams struct {
+	UserID   pgtype.Int8
+	LinkID   pgtype.Int8
+	FromTime pgtype.Timestamptz
+	ToTime   pgtype.Timestamptz
+}
+
+type ExportClicksRow struct {
+	LinkID         int64
+	Alias          string
+	ClickedAt      pgtype.Timestamptz
+	IpAddress      pgtype.Text
+	UserAgent      pgtype.Text
+	Referrer       pgtype.Text
+	ReferrerDomain pgtype.Text
+	Browser        pgtype.Text
+	Os             pgtype.Text
+	DeviceType     pgtype.Text
+	Country        pgtype.Text
+	Region         pgtype.Text
+	City           pgtype.Text
+	IsBot          bool
+	BotName        pgtype.Text
+	IsPreview      bool
+}
+
+// Raw clicks on the user's links in [from_time, to_time), optionally of a
+// single link, oldest first.
+func (q *Queries) ExportClicks(ctx context.Context, arg ExportClicksParams) ([]ExportClicksRow, error) {
+	rows, err := q.db.Query(ctx, exportClicks,
+		arg.UserID,
+		arg.LinkID,
+		arg.FromTime,
+		arg.ToTime,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ExportClicksRow
+	for rows.Next() {
+		var i ExportClicksRow
+		if err := rows.Scan(
+			&i.LinkID,
+			&i.Alias,
+			&i.ClickedAt,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.Referrer,
+			&i.ReferrerDomain,
+			&i.Browser,
+			&i.Os,
+			&i.DeviceType,
+			&i.Country,
+			&i.Region,
+			&i.City,
+			&i.IsBot,
+			&i.BotName,
+			&i.IsPreview,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getLinkAnalytics = `-- name: GetLinkAnalytics :many
 SELECT
     l.id,
     l.alias,
     l.original_url,
-    COUNT(c.id) AS total_clicks
+    COALESCE(SUM(d.clicks) FILTER (WHERE $1::boolean OR NOT d.is_bot), 0)::bigint AS total_clicks,
+    COALESCE(SUM(d.previews), 0)::bigint AS link_previews
 FROM
     links l
 LEFT JOIN
-    clicks c ON l.id = c.link_id
+    link_clicks_daily d ON l.id = d.link_id
 WHERE
-    l.user_id = $1
+    l.user_id = $2
 GROUP BY
     l.id
 ORDER BY
     total_clicks DESC
 `
 
+type GetLinkAnalyticsParams struct {
+	IncludeBots bool
+	UserID      pgtype.Int8
+}
+
 type GetLinkAnalyticsRow struct {
-	ID          int64
-	Alias       string
-	OriginalUrl string
-	TotalClicks int64
+	ID           int64
+	Alias        string
+	OriginalUrl  string
+	TotalClicks  int64
+	LinkPreviews int64
 }
 
-func (q *Queries) GetLinkAnalytics(ctx context.Context, userID pgtype.Int8) ([]GetLinkAnalyticsRow, error) {
-	rows, err := q.db.Query(ctx, getLinkAnalytics, userID)
+// Totals are read from the daily rollups, which keep counting clicks after
+// the raw rows are deleted by the retention job. Bots are only counted when
+// include_bots is set; link previews are counted on their own either way.
+func (q *Queries) GetLinkAnalytics(ctx context.Context, arg GetLinkAnalyticsParams) ([]GetLinkAnalyticsRow, error) {
+	rows, err := q.db.Query(ctx, getLinkAnalytics, arg.IncludeBots, arg.UserID)
 	if err != nil {
 		return nil, err
 	}
@@ -88,6 +223,7 @@ func (q *Queries) GetLinkAnalytics(ctx context.Context, userID pgtype.Int8) ([]G
 			&i.Alias,
 			&i.OriginalUrl,
 			&i.TotalClicks,
+			&i.LinkPreviews,
 		); err != nil {
 			return nil, err
 		}
@@ -98,3 +234,172 @@ func (q *Queries) GetLinkAnalytics(ctx context.Context, userID pgtype.Int8) ([]G
 	}
 	return items, nil
 }
+
+const getLinkClickBreakdown = `-- name: GetLinkClickBreakdown :many
+SELECT
+    COALESCE(CASE $1::text
+        WHEN 'browser' THEN c.browser
+        WHEN 'os' THEN c.os
+        WHEN 'device' THEN c.device_type
+        WHEN 'referrer' THEN c.referrer_domain
+        WHEN 'country' THEN c.country
+        WHEN 'region' THEN CASE WHEN c.region IS NOT NULL THEN concat_ws(', ', c.region, c.country) END
+        WHEN 'city' THEN CASE WHEN c.city IS NOT NULL THEN concat_ws(', ', c.city, c.region, c.country) END
+        WHEN 'bot' THEN c.bot_name
+    END, '')::text AS value,
+    COUNT(*) AS clicks
+FROM clicks c
+WHERE c.link_id = $2
+    AND c.clicked_at >= $3::timestamptz
+    AND c.clicked_at < $4::timestamptz
+    AND ($5::text IS NULL OR c.country = $5::text)
+    AND ($6::boolean OR NOT c.is_bot)
+    AND ($1::text <> 'bot' OR c.is_bot)
+GROUP BY 1
+ORDER BY clicks DESC, value
+`
+
+type GetLinkClickBreakdownParams struct {
+	Dimension   string
+	LinkID      int64
+	FromTime    pgtype.Timestamptz
+	ToTime      pgtype.Timestamptz
+	Country     pgtype.Text
+	IncludeBots bool
+}
+
+type GetLinkClickBreakdownRow struct {
+	Value  string
+	Clicks int64
+}
+
+// Counts clicks per value of one of the dimensions parsed at ingestion.
+// Missing values are returned as an empty string. Regions and cities are
+// qualified with their country since names repeat across countries. When
+// country is set, only clicks from that country are counted. The bot
+// dimension only counts bots.
+func (q *Queries) GetLinkClickBreakdown(ctx context.Context, arg GetLinkClickBreakdownParams) ([]GetLinkClickBreakdownRow, error) {
+	rows, err := q.db.Query(ctx, getLinkClickBreakdown,
+		arg.Dimension,
+		arg.LinkID,
+		arg.FromTime,
+		arg.ToTime,
+		arg.Country,
+		arg.IncludeBots,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetLinkClickBreakdownRow
+	for rows.Next() {
+		var i GetLinkClickBreakdownRow
+		if err := rows.Scan(&i.Value, &i.Clicks); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLinkClickTimeseries = `-- name: GetLinkClickTimeseries :many
+WITH buckets AS (
+    SELECT generate_series(
+        date_trunc($1::text, $2::timestamptz, $3::text),
+        date_trunc($1::text, $4::timestamptz - INTERVAL '1 microsecond', $3::text),
+        ('1 ' || $1::text)::interval,
+        $3::text
+    ) AS bucket_start
+),
+counts AS (
+    SELECT
+        date_trunc($1::text, c.clicked_at, $3::text) AS bucket_start,
+        COUNT(*) AS clicks
+    FROM clicks c
+    WHERE c.link_id = $5
+        AND c.clicked_at >= $2::timestamptz
+        AND c.clicked_at < $4::timestamptz
+        AND ($6::boolean OR NOT c.is_bot)
+    GROUP BY 1
+)
+SELECT
+    b.bucket_start::timestamptz AS bucket_start,
+    COALESCE(counts.clicks, 0)::bigint AS clicks
+FROM buckets b
+LEFT JOIN counts ON counts.bucket_start = b.bucket_start
+ORDER BY b.bucket_start
+`
+
+type GetLinkClickTimeseriesParams struct {
+	Bucket      string
+	FromTime    pgtype.Timestamptz
+	Tz          string
+	ToTime      pgtype.Timestamptz
+	LinkID      int64
+	IncludeBots bool
+}
+
+type GetLinkClickTimeseriesRow struct {
+	BucketStart pgtype.Timestamptz
+	Clicks      int64
+}
+
+// Buckets are truncated in the caller's time zone and every bucket between
+// from_time and to_time is returned, including those without clicks.
+func (q *Queries) GetLinkClickTimeseries(ctx context.Context, arg GetLinkClickTimeseriesParams) ([]GetLinkClickTimeseriesRow, error) {
+	rows, err := q.db.Query(ctx, getLinkClickTimeseries,
+		arg.Bucket,
+		arg.FromTime,
+		arg.Tz,
+		arg.ToTime,
+		arg.LinkID,
+		arg.IncludeBots,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetLinkClickTimeseriesRow
+	for rows.Next() {
+		var i GetLinkClickTimeseriesRow
+		if err := rows.Scan(&i.BucketStart, &i.Clicks); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeClicks = `-- name: PurgeClicks :one
+WITH purged AS (
+    DELETE FROM clicks
+    WHERE id IN (
+        SELECT id FROM clicks
+        WHERE clicked_at < $1::timestamptz
+        ORDER BY id
+        LIMIT $2::int
+    )
+    RETURNING id
+)
+SELECT COUNT(*) FROM purged
+`
+
+type PurgeClicksParams struct {
+	Before    pgtype.Timestamptz
+	BatchSize int32
+}
+
+// Deletes up to batch_size raw clicks older than before. Their counts stay in
+// the rollups. Returns how many clicks were deleted.
+func (q *Queries) PurgeClicks(ctx context.Context, arg PurgeClicksParams) (int64, error) {
+	row := q.db.QueryRow(ctx, purgeClicks, arg.Before, arg.BatchSize)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
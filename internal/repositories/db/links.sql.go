@@ -11,25 +11,47 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const countLinksForUser = `-- name: CountLinksForUser :one
+SELECT COUNT(*) FROM links
+WHERE user_id = $1
+`
+
+func (q *Queries) CountLinksForUser(ctx context.Context, userID pgtype.Int8) (int64, error) {
+	row := q.db.QueryRow(ctx, countLinksForUser, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createLink = `-- name: CreateLink :one
 INSERT INTO links (
     alias,
     original_url,
-    user_id 
+    user_id,
+    password_hash,
+    expires_at
 ) VALUES (
-    $1, $2, $3 
+    $1, $2, $3, $4, $5
 )
-RETURNING id, alias, original_url, password_hash, expires_at, created_at, updated_at, user_id
+RETURNING id, alias, original_url, password_hash, expires_at, created_at, updated_at, user_id, expired
 `
 
 type CreateLinkParams struct {
-	Alias       string
-	OriginalUrl string
-	UserID      pgtype.Int8
+	Alias        string
+	OriginalUrl  string
+	UserID       pgtype.Int8
+	PasswordHash []byte
+	ExpiresAt    pgtype.Timestamptz
 }
 
 func (q *Queries) CreateLink(ctx context.Context, arg CreateLinkParams) (Link, error) {
-	row := q.db.QueryRow(ctx, createLink, arg.Alias, arg.OriginalUrl, arg.UserID)
+	row := q.db.QueryRow(ctx, createLink,
+		arg.Alias,
+		arg.OriginalUrl,
+		arg.UserID,
+		arg.PasswordHash,
+		arg.ExpiresAt,
+	)
 	var i Link
 	err := row.Scan(
 		&i.ID,
@@ -40,12 +62,31 @@ func (q *Queries) CreateLink(ctx context.Context, arg CreateLinkParams) (Link, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
+		&i.Expired,
 	)
 	return i, err
 }
 
+const deleteLink = `-- name: DeleteLink :one
+DELETE FROM links
+WHERE id = $1 AND user_id = $2
+RETURNING alias
+`
+
+type DeleteLinkParams struct {
+	ID     int64
+	UserID pgtype.Int8
+}
+
+func (q *Queries) DeleteLink(ctx context.Context, arg DeleteLinkParams) (string, error) {
+	row := q.db.QueryRow(ctx, deleteLink, arg.ID, arg.UserID)
+	var alias string
+	err := row.Scan(&alias)
+	return alias, err
+}
+
 const getLinkByAlias = `-- name: GetLinkByAlias :one
-SELECT id, alias, original_url, password_hash, expires_at, created_at, updated_at, user_id FROM links
+SELECT id, alias, original_url, password_hash, expires_at, created_at, updated_at, user_id, expired FROM links
 WHERE alias = $1 LIMIT 1
 `
 
@@ -61,12 +102,40 @@ func (q *Queries) GetLinkByAlias(ctx context.Context, alias string) (Link, error
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
+		&i.Expired,
+	)
+	return i, err
+}
+
+const getLinkByIDForUser = `-- name: GetLinkByIDForUser :one
+SELECT id, alias, original_url, password_hash, expires_at, created_at, updated_at, user_id, expired FROM links
+WHERE id = $1 AND user_id = $2 LIMIT 1
+`
+
+type GetLinkByIDForUserParams struct {
+	ID     int64
+	UserID pgtype.Int8
+}
+
+func (q *Queries) GetLinkByIDForUser(ctx context.Context, arg GetLinkByIDForUserParams) (Link, error) {
+	row := q.db.QueryRow(ctx, getLinkByIDForUser, arg.ID, arg.UserID)
+	var i Link
+	err := row.Scan(
+		&i.ID,
+		&i.Alias,
+		&i.OriginalUrl,
+		&i.PasswordHash,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Expired,
 	)
 	return i, err
 }
 
 const getLinksByUserID = `-- name: GetLinksByUserID :many
-SELECT id, alias, original_url, password_hash, expires_at, created_at, updated_at, user_id FROM links
+SELECT id, alias, original_url, password_hash, expires_at, created_at, updated_at, user_id, expired FROM links
 WHERE user_id = $1
 ORDER BY created_at DESC
 `
@@ -89,6 +158,7 @@ func (q *Queries) GetLinksByUserID(ctx context.Context, userID pgtype.Int8) ([]L
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.UserID,
+			&i.Expired,
 		); err != nil {
 			return nil, err
 		}
@@ -99,3 +169,78 @@ func (q *Queries) GetLinksByUserID(ctx context.Context, userID pgtype.Int8) ([]L
 	}
 	return items, nil
 }
+
+const markExpiredLinks = `-- name: MarkExpiredLinks :many
+UPDATE links
+SET expired = TRUE, updated_at = NOW()
+WHERE expires_at <= NOW() AND NOT expired
+RETURNING alias
+`
+
+func (q *Queries) MarkExpiredLinks(ctx context.Context) ([]string, error) {
+	rows, err := q.db.Query(ctx, markExpiredLinks)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var alias string
+		if err := rows.Scan(&alias); err != nil {
+			return nil, err
+		}
+		items = append(items, alias)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateLink = `-- name: UpdateLink :one
+UPDATE links
+SET
+    alias = $3,
+    original_url = $4,
+    expires_at = $5,
+    password_hash = $6,
+    expired = $7,
+    updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING id, alias, original_url, password_hash, expires_at, created_at, updated_at, user_id, expired
+`
+
+type UpdateLinkParams struct {
+	ID           int64
+	UserID       pgtype.Int8
+	Alias        string
+	OriginalUrl  string
+	ExpiresAt    pgtype.Timestamptz
+	PasswordHash []byte
+	Expired      bool
+}
+
+func (q *Queries) UpdateLink(ctx context.Context, arg UpdateLinkParams) (Link, error) {
+	row := q.db.QueryRow(ctx, updateLink,
+		arg.ID,
+		arg.UserID,
+		arg.Alias,
+		arg.OriginalUrl,
+		arg.ExpiresAt,
+		arg.PasswordHash,
+		arg.Expired,
+	)
+	var i Link
+	err := row.Scan(
+		&i.ID,
+		&i.Alias,
+		&i.OriginalUrl,
+		&i.PasswordHash,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Expired,
+	)
+	return i, err
+}
@@ -8,13 +8,53 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type ApiToken struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	TokenHash  []byte
+	Prefix     string
+	Scopes     []string
+	CreatedAt  pgtype.Timestamptz
+	LastUsedAt pgtype.Timestamptz
+	ExpiresAt  pgtype.Timestamptz
+}
+
 type Click struct {
-	ID        int64
-	LinkID    int64
-	ClickedAt pgtype.Timestamptz
-	IpAddress pgtype.Text
-	UserAgent pgtype.Text
-	Referrer  pgtype.Text
+	ID             int64
+	LinkID         int64
+	ClickedAt      pgtype.Timestamptz
+	IpAddress      pgtype.Text
+	UserAgent      pgtype.Text
+	Referrer       pgtype.Text
+	Browser        pgtype.Text
+	Os             pgtype.Text
+	DeviceType     pgtype.Text
+	ReferrerDomain pgtype.Text
+	Country        pgtype.Text
+	Region         pgtype.Text
+	City           pgtype.Text
+	IsBot          bool
+	BotName        pgtype.Text
+	IsPreview      bool
+}
+
+type ExportJob struct {
+	ID         int64
+	UserID     int64
+	Dataset    string
+	Format     string
+	LinkID     pgtype.Int8
+	FromTime   pgtype.Timestamptz
+	ToTime     pgtype.Timestamptz
+	Status     string
+	FileName   pgtype.Text
+	RowCount   int64
+	Error      pgtype.Text
+	CreatedAt  pgtype.Timestamptz
+	StartedAt  pgtype.Timestamptz
+	FinishedAt pgtype.Timestamptz
+	ExpiresAt  pgtype.Timestamptz
 }
 
 type Link struct {
@@ -26,11 +66,53 @@ type Link struct {
 	CreatedAt    pgtype.Timestamptz
 	UpdatedAt    pgtype.Timestamptz
 	UserID       pgtype.Int8
+	Expired      bool
+}
+
+type LinkClicksDaily struct {
+	LinkID         int64
+	Day            pgtype.Date
+	Country        string
+	DeviceType     string
+	ReferrerDomain string
+	IsBot          bool
+	Clicks         int64
+	Previews       int64
+}
+
+type LinkClicksHourly struct {
+	LinkID         int64
+	Bucket         pgtype.Timestamptz
+	Country        string
+	DeviceType     string
+	ReferrerDomain string
+	IsBot          bool
+	Clicks         int64
+	Previews       int64
+}
+
+type LinkVisitorSketch struct {
+	LinkID    int64
+	Day       pgtype.Date
+	Sketch    []byte
+	UpdatedAt pgtype.Timestamptz
 }
 
 type User struct {
-	ID           int64
-	Email        string
-	PasswordHash []byte
-	CreatedAt    pgtype.Timestamptz
+	ID              int64
+	Email           string
+	PasswordHash    []byte
+	CreatedAt       pgtype.Timestamptz
+	IpMode          pgtype.Text
+	EmailVerifiedAt pgtype.Timestamptz
+}
+
+type UserToken struct {
+	ID        int64
+	UserID    int64
+	Purpose   string
+	NonceHash []byte
+	CreatedAt pgtype.Timestamptz
+	ExpiresAt pgtype.Timestamptz
+	UsedAt    pgtype.Timestamptz
 }
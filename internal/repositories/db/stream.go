@@ -0,0 +1,83 @@
+package db
+
+import "context"
+
+// The generated :many methods collect every row in a slice before returning.
+// The methods below run the same queries but hand each row to fn as pgx reads
+// it off the connection, so exports of any size run in constant memory.
+// Returning an error from fn stops the query.
+
+// ExportClicksEach is ExportClicks, one row at a time.
+func (q *Queries) ExportClicksEach(ctx context.Context, arg ExportClicksParams, fn func(ExportClicksRow) error) error {
+	rows, err := q.db.Query(ctx, exportClicks,
+		arg.UserID,
+		arg.LinkID,
+		arg.FromTime,
+		arg.ToTime,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var i ExportClicksRow
+		if err := rows.Scan(
+			&i.LinkID,
+			&i.Alias,
+			&i.ClickedAt,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.Referrer,
+			&i.ReferrerDomain,
+			&i.Browser,
+			&i.Os,
+			&i.DeviceType,
+			&i.Country,
+			&i.Region,
+			&i.City,
+			&i.IsBot,
+			&i.BotName,
+			&i.IsPreview,
+		); err != nil {
+			return err
+		}
+		if err := fn(i); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ExportDailyRollupsEach is ExportDailyRollups, one row at a time.
+func (q *Queries) ExportDailyRollupsEach(ctx context.Context, arg ExportDailyRollupsParams, fn func(ExportDailyRollupsRow) error) error {
+	rows, err := q.db.Query(ctx, exportDailyRollups,
+		arg.UserID,
+		arg.LinkID,
+		arg.FromDay,
+		arg.ToDay,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var i ExportDailyRollupsRow
+		if err := rows.Scan(
+			&i.LinkID,
+			&i.Alias,
+			&i.Day,
+			&i.Country,
+			&i.DeviceType,
+			&i.ReferrerDomain,
+			&i.IsBot,
+			&i.Clicks,
+			&i.Previews,
+		); err != nil {
+			return err
+		}
+		if err := fn(i); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
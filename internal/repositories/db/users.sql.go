@@ -7,12 +7,14 @@ package db
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (email, password_hash)
 VALUES ($1, $2)
-RETURNING id, email, password_hash, created_at
+RETURNING id, email, password_hash, created_at, ip_mode, email_verified_at
 `
 
 type CreateUserParams struct {
@@ -28,12 +30,49 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.PasswordHash,
 		&i.CreatedAt,
+		&i.IpMode,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
+const getIPModesForLinks = `-- name: GetIPModesForLinks :many
+SELECT l.id AS link_id, u.ip_mode
+FROM links l
+JOIN users u ON u.id = l.user_id
+WHERE l.id = ANY($1::bigint[])
+    AND u.ip_mode IS NOT NULL
+`
+
+type GetIPModesForLinksRow struct {
+	LinkID int64
+	IpMode pgtype.Text
+}
+
+// Returns the owners' IP mode for those of the links whose owner overrides
+// the deployment default.
+func (q *Queries) GetIPModesForLinks(ctx context.Context, linkIds []int64) ([]GetIPModesForLinksRow, error) {
+	rows, err := q.db.Query(ctx, getIPModesForLinks, linkIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetIPModesForLinksRow
+	for rows.Next() {
+		var i GetIPModesForLinksRow
+		if err := rows.Scan(&i.LinkID, &i.IpMode); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, password_hash, created_at FROM users
+SELECT id, email, password_hash, created_at, ip_mode, email_verified_at FROM users
 WHERE email = $1 LIMIT 1
 `
 
@@ -45,12 +84,14 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.PasswordHash,
 		&i.CreatedAt,
+		&i.IpMode,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, email, password_hash, created_at FROM users
+SELECT id, email, password_hash, created_at, ip_mode, email_verified_at FROM users
 WHERE id = $1 LIMIT 1
 `
 
@@ -62,6 +103,61 @@ func (q *Queries) GetUserByID(ctx context.Context, id int64) (User, error) {
 		&i.Email,
 		&i.PasswordHash,
 		&i.CreatedAt,
+		&i.IpMode,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const markUserEmailVerified = `-- name: MarkUserEmailVerified :exec
+UPDATE users
+SET email_verified_at = COALESCE(email_verified_at, NOW())
+WHERE id = $1
+`
+
+func (q *Queries) MarkUserEmailVerified(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, markUserEmailVerified, id)
+	return err
+}
+
+const updateUserIPMode = `-- name: UpdateUserIPMode :one
+UPDATE users
+SET ip_mode = $2
+WHERE id = $1
+RETURNING id, email, password_hash, created_at, ip_mode, email_verified_at
+`
+
+type UpdateUserIPModeParams struct {
+	ID     int64
+	IpMode pgtype.Text
+}
+
+func (q *Queries) UpdateUserIPMode(ctx context.Context, arg UpdateUserIPModeParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserIPMode, arg.ID, arg.IpMode)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.CreatedAt,
+		&i.IpMode,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET password_hash = $2
+WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID           int64
+	PasswordHash []byte
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.Exec(ctx, updateUserPassword, arg.ID, arg.PasswordHash)
+	return err
+}
@@ -0,0 +1,24 @@
+-- name: CreateAPIToken :one
+INSERT INTO api_tokens (user_id, name, token_hash, prefix, scopes, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: ListAPITokensForUser :many
+SELECT * FROM api_tokens
+WHERE user_id = $1
+ORDER BY id;
+
+-- name: GetAPITokenByHash :one
+-- Returns the token unless it has expired.
+SELECT * FROM api_tokens
+WHERE token_hash = $1
+    AND (expires_at IS NULL OR expires_at > NOW());
+
+-- name: TouchAPIToken :exec
+UPDATE api_tokens
+SET last_used_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteAPITokenForUser :execrows
+DELETE FROM api_tokens
+WHERE id = $1 AND user_id = $2;
@@ -10,18 +10,142 @@ INSERT INTO clicks (
 RETURNING *;
 
 -- name: GetLinkAnalytics :many
+-- Totals are read from the daily rollups, which keep counting clicks after
+-- the raw rows are deleted by the retention job. Bots are only counted when
+-- include_bots is set; link previews are counted on their own either way.
 SELECT
     l.id,
     l.alias,
     l.original_url,
-    COUNT(c.id) AS total_clicks
+    COALESCE(SUM(d.clicks) FILTER (WHERE @include_bots::boolean OR NOT d.is_bot), 0)::bigint AS total_clicks,
+    COALESCE(SUM(d.previews), 0)::bigint AS link_previews
 FROM
     links l
 LEFT JOIN
-    clicks c ON l.id = c.link_id
+    link_clicks_daily d ON l.id = d.link_id
 WHERE
-    l.user_id = $1
+    l.user_id = @user_id
 GROUP BY
     l.id
 ORDER BY
-    total_clicks DESC;
\ No newline at end of file
+    total_clicks DESC;
+-- name: CreateClicks :copyfrom
+INSERT INTO clicks (
+    link_id,
+    clicked_at,
+    ip_address,
+    user_agent,
+    referrer,
+    browser,
+    os,
+    device_type,
+    referrer_domain,
+    country,
+    region,
+    city,
+    is_bot,
+    bot_name,
+    is_preview
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15
+);
+
+-- name: GetLinkClickTimeseries :many
+-- Buckets are truncated in the caller's time zone and every bucket between
+-- from_time and to_time is returned, including those without clicks.
+WITH buckets AS (
+    SELECT generate_series(
+        date_trunc(@bucket::text, @from_time::timestamptz, @tz::text),
+        date_trunc(@bucket::text, @to_time::timestamptz - INTERVAL '1 microsecond', @tz::text),
+        ('1 ' || @bucket::text)::interval,
+        @tz::text
+    ) AS bucket_start
+),
+counts AS (
+    SELECT
+        date_trunc(@bucket::text, c.clicked_at, @tz::text) AS bucket_start,
+        COUNT(*) AS clicks
+    FROM clicks c
+    WHERE c.link_id = @link_id
+        AND c.clicked_at >= @from_time::timestamptz
+        AND c.clicked_at < @to_time::timestamptz
+        AND (@include_bots::boolean OR NOT c.is_bot)
+    GROUP BY 1
+)
+SELECT
+    b.bucket_start::timestamptz AS bucket_start,
+    COALESCE(counts.clicks, 0)::bigint AS clicks
+FROM buckets b
+LEFT JOIN counts ON counts.bucket_start = b.bucket_start
+ORDER BY b.bucket_start;
+
+-- name: GetLinkClickBreakdown :many
+-- Counts clicks per value of one of the dimensions parsed at ingestion.
+-- Missing values are returned as an empty string. Regions and cities are
+-- qualified with their country since names repeat across countries. When
+-- country is set, only clicks from that country are counted. The bot
+-- dimension only counts bots.
+SELECT
+    COALESCE(CASE @dimension::text
+        WHEN 'browser' THEN c.browser
+        WHEN 'os' THEN c.os
+        WHEN 'device' THEN c.device_type
+        WHEN 'referrer' THEN c.referrer_domain
+        WHEN 'country' THEN c.country
+        WHEN 'region' THEN CASE WHEN c.region IS NOT NULL THEN concat_ws(', ', c.region, c.country) END
+        WHEN 'city' THEN CASE WHEN c.city IS NOT NULL THEN concat_ws(', ', c.city, c.region, c.country) END
+        WHEN 'bot' THEN c.bot_name
+    END, '')::text AS value,
+    COUNT(*) AS clicks
+FROM clicks c
+WHERE c.link_id = @link_id
+    AND c.clicked_at >= @from_time::timestamptz
+    AND c.clicked_at < @to_time::timestamptz
+    AND (sqlc.narg(country)::text IS NULL OR c.country = sqlc.narg(country)::text)
+    AND (@include_bots::boolean OR NOT c.is_bot)
+    AND (@dimension::text <> 'bot' OR c.is_bot)
+GROUP BY 1
+ORDER BY clicks DESC, value;
+
+-- name: PurgeClicks :one
+-- Deletes up to batch_size raw clicks older than before. Their counts stay in
+-- the rollups. Returns how many clicks were deleted.
+WITH purged AS (
+    DELETE FROM clicks
+    WHERE id IN (
+        SELECT id FROM clicks
+        WHERE clicked_at < @before::timestamptz
+        ORDER BY id
+        LIMIT @batch_size::int
+    )
+    RETURNING id
+)
+SELECT COUNT(*) FROM purged;
+
+-- name: ExportClicks :many
+-- Raw clicks on the user's links in [from_time, to_time), optionally of a
+-- single link, oldest first.
+SELECT
+    c.link_id,
+    l.alias,
+    c.clicked_at,
+    c.ip_address,
+    c.user_agent,
+    c.referrer,
+    c.referrer_domain,
+    c.browser,
+    c.os,
+    c.device_type,
+    c.country,
+    c.region,
+    c.city,
+    c.is_bot,
+    c.bot_name,
+    c.is_preview
+FROM clicks c
+JOIN links l ON l.id = c.link_id
+WHERE l.user_id = @user_id
+    AND (sqlc.narg(link_id)::bigint IS NULL OR c.link_id = sqlc.narg(link_id)::bigint)
+    AND c.clicked_at >= @from_time::timestamptz
+    AND c.clicked_at < @to_time::timestamptz
+ORDER BY c.clicked_at, c.id;
@@ -0,0 +1,61 @@
+-- name: CreateExportJob :one
+INSERT INTO export_jobs (user_id, dataset, format, link_id, from_time, to_time)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetExportJobForUser :one
+SELECT * FROM export_jobs
+WHERE id = $1 AND user_id = $2;
+
+-- name: ListExportJobsForUser :many
+SELECT * FROM export_jobs
+WHERE user_id = $1
+ORDER BY id DESC
+LIMIT 50;
+
+-- name: ClaimExportJob :one
+-- Takes the oldest pending job, or a running one whose worker has not
+-- finished it since stale_before, and marks it running.
+UPDATE export_jobs
+SET status = 'running', started_at = NOW()
+WHERE id = (
+    SELECT id FROM export_jobs
+    WHERE status = 'pending'
+        OR (status = 'running' AND started_at < @stale_before::timestamptz)
+    ORDER BY id
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: ReleaseExportJob :exec
+-- Puts a job the worker could not finish back in the queue.
+UPDATE export_jobs
+SET status = 'pending', started_at = NULL
+WHERE id = $1 AND status = 'running';
+
+-- name: CompleteExportJob :exec
+UPDATE export_jobs
+SET status = 'done', file_name = $2, row_count = $3, finished_at = NOW(), expires_at = $4
+WHERE id = $1;
+
+-- name: FailExportJob :exec
+UPDATE export_jobs
+SET status = 'failed', error = $2, finished_at = NOW(), expires_at = $3
+WHERE id = $1;
+
+-- name: DeleteExpiredExportJobs :many
+-- Removes finished jobs past their expiry and returns the names of their
+-- files so they can be deleted too.
+DELETE FROM export_jobs
+WHERE expires_at < NOW()
+RETURNING file_name;
+
+-- name: LockExportJobsForUser :exec
+-- Held while a job is created, so concurrent requests cannot both pass the
+-- active job cap.
+SELECT pg_advisory_xact_lock(hashtextextended('export_jobs:' || @user_id::bigint, 0));
+
+-- name: CountActiveExportJobsForUser :one
+SELECT COUNT(*) FROM export_jobs
+WHERE user_id = $1 AND status IN ('pending', 'running');
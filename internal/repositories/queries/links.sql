@@ -1,11 +1,12 @@
-
 -- name: CreateLink :one
 INSERT INTO links (
     alias,
     original_url,
-    user_id 
+    user_id,
+    password_hash,
+    expires_at
 ) VALUES (
-    $1, $2, $3 
+    $1, $2, $3, $4, $5
 )
 RETURNING *;
 
@@ -14,6 +15,37 @@ SELECT * FROM links
 WHERE user_id = $1
 ORDER BY created_at DESC;
 
+-- name: CountLinksForUser :one
+SELECT COUNT(*) FROM links
+WHERE user_id = $1;
+
 -- name: GetLinkByAlias :one
 SELECT * FROM links
-WHERE alias = $1 LIMIT 1;
\ No newline at end of file
+WHERE alias = $1 LIMIT 1;
+
+-- name: MarkExpiredLinks :many
+UPDATE links
+SET expired = TRUE, updated_at = NOW()
+WHERE expires_at <= NOW() AND NOT expired
+RETURNING alias;
+
+-- name: GetLinkByIDForUser :one
+SELECT * FROM links
+WHERE id = $1 AND user_id = $2 LIMIT 1;
+
+-- name: UpdateLink :one
+UPDATE links
+SET
+    alias = $3,
+    original_url = $4,
+    expires_at = $5,
+    password_hash = $6,
+    expired = $7,
+    updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteLink :one
+DELETE FROM links
+WHERE id = $1 AND user_id = $2
+RETURNING alias;
@@ -0,0 +1,158 @@
+-- name: LockRollupsShared :exec
+-- Taken by every transaction that writes clicks, so a backfill holding the
+-- exclusive lock never rebuilds a day while clicks for it are in flight.
+SELECT pg_advisory_xact_lock_shared(hashtext('link_clicks_rollups'));
+
+-- name: LockRollups :exec
+SELECT pg_advisory_xact_lock(hashtext('link_clicks_rollups'));
+
+-- name: UpsertHourlyRollups :exec
+-- Adds pre-aggregated counts to the hourly rollups. Each key may appear only
+-- once per call.
+INSERT INTO link_clicks_hourly (link_id, bucket, country, device_type, referrer_domain, is_bot, clicks, previews)
+SELECT * FROM unnest(
+    @link_ids::bigint[],
+    @buckets::timestamptz[],
+    @countries::text[],
+    @device_types::text[],
+    @referrer_domains::text[],
+    @is_bots::boolean[],
+    @clicks::bigint[],
+    @previews::bigint[]
+)
+ON CONFLICT (link_id, bucket, country, device_type, referrer_domain, is_bot) DO UPDATE
+    SET clicks = link_clicks_hourly.clicks + EXCLUDED.clicks,
+        previews = link_clicks_hourly.previews + EXCLUDED.previews;
+
+-- name: UpsertDailyRollups :exec
+-- Adds pre-aggregated counts to the daily rollups. Each key may appear only
+-- once per call.
+INSERT INTO link_clicks_daily (link_id, day, country, device_type, referrer_domain, is_bot, clicks, previews)
+SELECT * FROM unnest(
+    @link_ids::bigint[],
+    @days::date[],
+    @countries::text[],
+    @device_types::text[],
+    @referrer_domains::text[],
+    @is_bots::boolean[],
+    @clicks::bigint[],
+    @previews::bigint[]
+)
+ON CONFLICT (link_id, day, country, device_type, referrer_domain, is_bot) DO UPDATE
+    SET clicks = link_clicks_daily.clicks + EXCLUDED.clicks,
+        previews = link_clicks_daily.previews + EXCLUDED.previews;
+
+-- name: DeleteHourlyRollups :exec
+DELETE FROM link_clicks_hourly
+WHERE bucket >= @from_time::timestamptz AND bucket < @to_time::timestamptz;
+
+-- name: DeleteDailyRollups :exec
+DELETE FROM link_clicks_daily
+WHERE day >= @from_day::date AND day < @to_day::date;
+
+-- name: RebuildHourlyRollups :execrows
+-- Recomputes the hourly rollups of [from_time, to_time) from raw clicks. The
+-- range must have been deleted first.
+INSERT INTO link_clicks_hourly (link_id, bucket, country, device_type, referrer_domain, is_bot, clicks, previews)
+SELECT
+    link_id,
+    date_trunc('hour', clicked_at, 'UTC'),
+    COALESCE(country, ''),
+    COALESCE(device_type, ''),
+    COALESCE(referrer_domain, ''),
+    is_bot,
+    COUNT(*),
+    COUNT(*) FILTER (WHERE is_preview)
+FROM clicks
+WHERE clicked_at >= @from_time::timestamptz AND clicked_at < @to_time::timestamptz
+GROUP BY 1, 2, 3, 4, 5, 6;
+
+-- name: RebuildDailyRollups :execrows
+-- Recomputes the daily rollups of [from_time, to_time) from raw clicks. The
+-- range must cover whole UTC days and have been deleted first.
+INSERT INTO link_clicks_daily (link_id, day, country, device_type, referrer_domain, is_bot, clicks, previews)
+SELECT
+    link_id,
+    (clicked_at AT TIME ZONE 'UTC')::date,
+    COALESCE(country, ''),
+    COALESCE(device_type, ''),
+    COALESCE(referrer_domain, ''),
+    is_bot,
+    COUNT(*),
+    COUNT(*) FILTER (WHERE is_preview)
+FROM clicks
+WHERE clicked_at >= @from_time::timestamptz AND clicked_at < @to_time::timestamptz
+GROUP BY 1, 2, 3, 4, 5, 6;
+
+-- name: GetOldestClickTime :one
+SELECT MIN(clicked_at)::timestamptz AS oldest FROM clicks;
+
+-- name: GetLinkRollupTimeseries :many
+-- Same result as GetLinkClickTimeseries, read from the hourly rollups. Only
+-- valid when from_time and to_time are whole hours and tz is a whole number
+-- of hours from UTC over the range, so every hour falls in a single bucket.
+WITH buckets AS (
+    SELECT generate_series(
+        date_trunc(@bucket::text, @from_time::timestamptz, @tz::text),
+        date_trunc(@bucket::text, @to_time::timestamptz - INTERVAL '1 microsecond', @tz::text),
+        ('1 ' || @bucket::text)::interval,
+        @tz::text
+    ) AS bucket_start
+),
+counts AS (
+    SELECT
+        date_trunc(@bucket::text, h.bucket, @tz::text) AS bucket_start,
+        SUM(h.clicks) AS clicks
+    FROM link_clicks_hourly h
+    WHERE h.link_id = @link_id
+        AND h.bucket >= @from_time::timestamptz
+        AND h.bucket < @to_time::timestamptz
+        AND (@include_bots::boolean OR NOT h.is_bot)
+    GROUP BY 1
+)
+SELECT
+    b.bucket_start::timestamptz AS bucket_start,
+    COALESCE(counts.clicks, 0)::bigint AS clicks
+FROM buckets b
+LEFT JOIN counts ON counts.bucket_start = b.bucket_start
+ORDER BY b.bucket_start;
+
+-- name: GetLinkRollupBreakdown :many
+-- Same result as GetLinkClickBreakdown for the dimensions kept in the
+-- rollups (country, device and referrer), read from the hourly rollups.
+SELECT
+    (CASE @dimension::text
+        WHEN 'country' THEN h.country
+        WHEN 'device' THEN h.device_type
+        WHEN 'referrer' THEN h.referrer_domain
+    END)::text AS value,
+    SUM(h.clicks)::bigint AS clicks
+FROM link_clicks_hourly h
+WHERE h.link_id = @link_id
+    AND h.bucket >= @from_time::timestamptz
+    AND h.bucket < @to_time::timestamptz
+    AND (sqlc.narg(country)::text IS NULL OR h.country = sqlc.narg(country)::text)
+    AND (@include_bots::boolean OR NOT h.is_bot)
+GROUP BY 1
+ORDER BY clicks DESC, value;
+
+-- name: ExportDailyRollups :many
+-- Daily rollups of the user's links in [from_day, to_day), optionally of a
+-- single link.
+SELECT
+    d.link_id,
+    l.alias,
+    d.day,
+    d.country,
+    d.device_type,
+    d.referrer_domain,
+    d.is_bot,
+    d.clicks,
+    d.previews
+FROM link_clicks_daily d
+JOIN links l ON l.id = d.link_id
+WHERE l.user_id = @user_id
+    AND (sqlc.narg(link_id)::bigint IS NULL OR d.link_id = sqlc.narg(link_id)::bigint)
+    AND d.day >= @from_day::date
+    AND d.day < @to_day::date
+ORDER BY d.day, d.link_id, d.country, d.device_type, d.referrer_domain, d.is_bot;
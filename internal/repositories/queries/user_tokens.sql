@@ -0,0 +1,17 @@
+-- name: CreateUserToken :exec
+-- Replaces the user's earlier token for the purpose, which stops it working.
+INSERT INTO user_tokens (user_id, purpose, nonce_hash, expires_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, purpose) DO UPDATE
+SET nonce_hash = EXCLUDED.nonce_hash,
+    created_at = NOW(),
+    expires_at = EXCLUDED.expires_at,
+    used_at = NULL;
+
+-- name: ConsumeUserToken :execrows
+-- Marks the token used. No row is affected when it was already used, has
+-- been replaced by a newer token or has expired.
+UPDATE user_tokens
+SET used_at = NOW()
+WHERE nonce_hash = $1 AND user_id = $2 AND purpose = $3
+    AND used_at IS NULL AND expires_at > NOW();
@@ -9,4 +9,29 @@ WHERE email = $1 LIMIT 1;
 
 -- name: GetUserByID :one
 SELECT * FROM users
-WHERE id = $1 LIMIT 1;
\ No newline at end of file
+WHERE id = $1 LIMIT 1;
+
+-- name: UpdateUserIPMode :one
+UPDATE users
+SET ip_mode = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: GetIPModesForLinks :many
+-- Returns the owners' IP mode for those of the links whose owner overrides
+-- the deployment default.
+SELECT l.id AS link_id, u.ip_mode
+FROM links l
+JOIN users u ON u.id = l.user_id
+WHERE l.id = ANY(@link_ids::bigint[])
+    AND u.ip_mode IS NOT NULL;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET password_hash = $2
+WHERE id = $1;
+
+-- name: MarkUserEmailVerified :exec
+UPDATE users
+SET email_verified_at = COALESCE(email_verified_at, NOW())
+WHERE id = $1;
@@ -0,0 +1,16 @@
+-- name: UpsertVisitorSketch :exec
+INSERT INTO link_visitor_sketches (link_id, day, sketch)
+VALUES ($1, $2, $3)
+ON CONFLICT (link_id, day) DO UPDATE
+    SET sketch = EXCLUDED.sketch,
+        updated_at = NOW();
+
+-- name: GetVisitorSketch :one
+SELECT sketch FROM link_visitor_sketches
+WHERE link_id = $1 AND day = $2;
+
+-- name: GetVisitorSketches :many
+SELECT link_id, day, sketch FROM link_visitor_sketches
+WHERE link_id = ANY(@link_ids::bigint[])
+    AND day >= @from_day::date
+    AND day <= @to_day::date;
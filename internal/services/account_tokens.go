@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sumanthd032/go-shorty/internal/config"
+	"github.com/sumanthd032/go-shorty/internal/repositories/db"
+)
+
+// Purposes of account tokens, as stored in user_tokens.purpose. A token only
+// works for the purpose it was issued for.
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+)
+
+var ErrInvalidAccountToken = errors.New("link is invalid or has expired")
+
+// accountToken is the signed payload of an emailed link.
+type accountToken struct {
+	UserID int64  `json:"u"`
+	Nonce  []byte `json:"n"`
+}
+
+// AccountTokens issues the tokens in verification and password reset links.
+// A token is signed with the session key and carries its issue time, so
+// forged or expired tokens are rejected without a database lookup; a
+// user_tokens row, keyed by a hash of the token's nonce, makes it single-use.
+// There is one row per user and purpose, so issuing a token atomically
+// invalidates the user's earlier one for the same purpose.
+type AccountTokens struct {
+	queries *db.Queries
+	codecs  map[string]*securecookie.SecureCookie
+	ttls    map[string]time.Duration
+}
+
+func NewAccountTokens(queries *db.Queries, cfg config.AuthConfig) *AccountTokens {
+	ttls := map[string]time.Duration{
+		TokenPurposeVerifyEmail:   cfg.VerifyTokenTTL,
+		TokenPurposeResetPassword: cfg.ResetTokenTTL,
+	}
+	codecs := make(map[string]*securecookie.SecureCookie, len(ttls))
+	for purpose, ttl := range ttls {
+		codecs[purpose] = securecookie.New([]byte(cfg.SessionKey), nil).
+			MaxAge(int(ttl.Seconds())).
+			SetSerializer(securecookie.JSONEncoder{})
+	}
+	return &AccountTokens{queries: queries, codecs: codecs, ttls: ttls}
+}
+
+// TTL is how long tokens for purpose stay valid.
+func (t *AccountTokens) TTL(purpose string) time.Duration {
+	return t.ttls[purpose]
+}
+
+// Issue returns a new token for the user.
+func (t *AccountTokens) Issue(ctx context.Context, userID int64, purpose string) (string, error) {
+	codec, ok := t.codecs[purpose]
+	if !ok {
+		return "", fmt.Errorf("unknown token purpose %q", purpose)
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("could not generate token: %w", err)
+	}
+	token, err := codec.Encode(purpose, accountToken{UserID: userID, Nonce: nonce})
+	if err != nil {
+		return "", fmt.Errorf("could not sign token: %w", err)
+	}
+
+	hash := sha256.Sum256(nonce)
+	err = t.queries.CreateUserToken(ctx, db.CreateUserTokenParams{
+		UserID:    userID,
+		Purpose:   purpose,
+		NonceHash: hash[:],
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(t.ttls[purpose]), Valid: true},
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not store token: %w", err)
+	}
+	return token, nil
+}
+
+// Consume checks the token and marks it used, returning its user. It fails
+// with ErrInvalidAccountToken for a bad signature, another purpose, an
+// expired or already used token, or one superseded by a newer token.
+func (t *AccountTokens) Consume(ctx context.Context, token, purpose string) (int64, error) {
+	codec, ok := t.codecs[purpose]
+	if !ok {
+		return 0, fmt.Errorf("unknown token purpose %q", purpose)
+	}
+	var payload accountToken
+	if err := codec.Decode(purpose, token, &payload); err != nil {
+		return 0, ErrInvalidAccountToken
+	}
+
+	hash := sha256.Sum256(payload.Nonce)
+	consumed, err := t.queries.ConsumeUserToken(ctx, db.ConsumeUserTokenParams{
+		NonceHash: hash[:],
+		UserID:    payload.UserID,
+		Purpose:   purpose,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("could not use token: %w", err)
+	}
+	if consumed == 0 {
+		return 0, ErrInvalidAccountToken
+	}
+	return payload.UserID, nil
+}
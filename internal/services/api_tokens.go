@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sumanthd032/go-shorty/internal/repositories/db"
+)
+
+// API token scopes. A token may only call the endpoints its scopes allow.
+const (
+	ScopeLinksRead     = "links:read"
+	ScopeLinksWrite    = "links:write"
+	ScopeAnalyticsRead = "analytics:read"
+)
+
+// apiTokenPrefix marks go-shorty tokens so they are easy to recognise, e.g.
+// by secret scanners.
+const apiTokenPrefix = "gs_"
+
+var (
+	ErrInvalidToken       = errors.New("invalid or expired token")
+	ErrInvalidScope       = errors.New("scopes must be one or more of links:read, links:write, analytics:read")
+	ErrInvalidTokenName   = errors.New("name must be between 1 and 100 characters")
+	ErrInvalidTokenExpiry = errors.New("expires_at must be in the future")
+	ErrAPITokenNotFound   = errors.New("token not found")
+)
+
+// tokenLastUsedPrecision is how stale a token's last_used_at may get. Busy
+// tokens would otherwise write to the database on every request.
+const tokenLastUsedPrecision = time.Minute
+
+// ValidScope reports whether scope is one of the API token scopes.
+func ValidScope(scope string) bool {
+	switch scope {
+	case ScopeLinksRead, ScopeLinksWrite, ScopeAnalyticsRead:
+		return true
+	}
+	return false
+}
+
+// APITokenService issues and checks personal API tokens. Tokens are 32 random
+// bytes, so a plain SHA-256 is enough to store them safely and lets a request
+// look its token up by hash.
+type APITokenService struct {
+	queries *db.Queries
+}
+
+func NewAPITokenService(queries *db.Queries) *APITokenService {
+	return &APITokenService{queries: queries}
+}
+
+// Create issues a token for the user. The returned string is the only time
+// the token is available in clear. A zero expiresAt never expires.
+func (s *APITokenService) Create(ctx context.Context, userID int64, name string, scopes []string, expiresAt time.Time) (string, db.ApiToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return "", db.ApiToken{}, ErrInvalidTokenName
+	}
+	if len(scopes) == 0 {
+		return "", db.ApiToken{}, ErrInvalidScope
+	}
+	unique := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !ValidScope(scope) {
+			return "", db.ApiToken{}, ErrInvalidScope
+		}
+		if !slices.Contains(unique, scope) {
+			unique = append(unique, scope)
+		}
+	}
+	if !expiresAt.IsZero() && !expiresAt.After(time.Now()) {
+		return "", db.ApiToken{}, ErrInvalidTokenExpiry
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", db.ApiToken{}, fmt.Errorf("could not generate token: %w", err)
+	}
+	token := apiTokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	hash := sha256.Sum256([]byte(token))
+
+	record, err := s.queries.CreateAPIToken(ctx, db.CreateAPITokenParams{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: hash[:],
+		Prefix:    token[:len(apiTokenPrefix)+6],
+		Scopes:    unique,
+		ExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: !expiresAt.IsZero()},
+	})
+	if err != nil {
+		return "", db.ApiToken{}, fmt.Errorf("could not create token: %w", err)
+	}
+	return token, record, nil
+}
+
+// Authenticate returns the user and scopes of a valid, unexpired token and
+// records that it was used.
+func (s *APITokenService) Authenticate(ctx context.Context, token string) (int64, []string, error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return 0, nil, ErrInvalidToken
+	}
+	hash := sha256.Sum256([]byte(token))
+	record, err := s.queries.GetAPITokenByHash(ctx, hash[:])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil, ErrInvalidToken
+		}
+		return 0, nil, fmt.Errorf("could not look up token: %w", err)
+	}
+
+	if !record.LastUsedAt.Valid || time.Since(record.LastUsedAt.Time) > tokenLastUsedPrecision {
+		if err := s.queries.TouchAPIToken(ctx, record.ID); err != nil {
+			log.Printf("Failed to record use of API token %d: %v", record.ID, err)
+		}
+	}
+	return record.UserID, record.Scopes, nil
+}
+
+// List returns the user's tokens. Only their hashes are stored.
+func (s *APITokenService) List(ctx context.Context, userID int64) ([]db.ApiToken, error) {
+	tokens, err := s.queries.ListAPITokensForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("could not list tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// Revoke deletes one of the user's tokens; it stops working immediately.
+func (s *APITokenService) Revoke(ctx context.Context, userID, tokenID int64) error {
+	deleted, err := s.queries.DeleteAPITokenForUser(ctx, db.DeleteAPITokenForUserParams{ID: tokenID, UserID: userID})
+	if err != nil {
+		return fmt.Errorf("could not revoke token: %w", err)
+	}
+	if deleted == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
@@ -0,0 +1,377 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sumanthd032/go-shorty/internal/config"
+)
+
+// Overflow policies applied while the stream backlog is above the high-water mark.
+const (
+	OverflowDrop   = "drop"
+	OverflowSample = "sample"
+	OverflowSpill  = "spill"
+)
+
+// StreamStats describes the click stream as last observed by the monitor.
+type StreamStats struct {
+	Length        int64  `json:"length"`
+	Lag           int64  `json:"lag"`
+	Pending       int64  `json:"pending"`
+	Backlog       int64  `json:"backlog"`
+	HighWaterMark int64  `json:"high_water_mark"`
+	Overflowing   bool   `json:"overflowing"`
+	Policy        string `json:"overflow_policy"`
+	Dropped       int64  `json:"dropped"`
+	Spilled       int64  `json:"spilled"`
+	SpillPending  int64  `json:"spill_pending"`
+	CheckedAt     string `json:"checked_at,omitempty"`
+}
+
+// ClickPublisher adds click events to the Redis stream. It trims the stream
+// according to the configured MAXLEN/MINID policy and, while the worker is
+// falling behind, applies the overflow policy instead of growing Redis memory
+// without bound.
+type ClickPublisher struct {
+	cache *redis.Client
+	cfg   config.ClickStreamConfig
+	spill *spillBuffer
+
+	overflowing atomic.Bool
+	dropped     atomic.Int64
+	spilled     atomic.Int64
+
+	mu    sync.Mutex
+	stats StreamStats
+}
+
+// NewClickPublisher creates a publisher. With the spill policy the on-disk
+// buffer is opened straight away so a bad path fails at startup.
+func NewClickPublisher(cache *redis.Client, cfg config.ClickStreamConfig) (*ClickPublisher, error) {
+	p := &ClickPublisher{cache: cache, cfg: cfg}
+	switch cfg.OverflowPolicy {
+	case "", OverflowDrop, OverflowSample:
+	case OverflowSpill:
+		spill, err := openSpillBuffer(cfg.SpillPath)
+		if err != nil {
+			return nil, err
+		}
+		p.spill = spill
+	default:
+		return nil, fmt.Errorf("unknown click stream overflow policy %q", cfg.OverflowPolicy)
+	}
+	return p, nil
+}
+
+// Publish adds the event to the stream, or drops, samples or spills it when
+// the backlog is above the high-water mark.
+func (p *ClickPublisher) Publish(ctx context.Context, event ClickEvent) {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to marshal click event: %v", err)
+		return
+	}
+
+	if p.overflowing.Load() {
+		switch p.cfg.OverflowPolicy {
+		case OverflowSpill:
+			if err := p.spill.Append(eventJSON); err != nil {
+				log.Printf("Failed to spill click event: %v", err)
+				p.dropped.Add(1)
+				return
+			}
+			p.spilled.Add(1)
+			return
+		case OverflowSample:
+			if rand.Float64() >= p.cfg.SampleRate {
+				p.dropped.Add(1)
+				return
+			}
+		default:
+			p.dropped.Add(1)
+			return
+		}
+	}
+
+	if err := p.add(ctx, p.cache, eventJSON).Err(); err != nil {
+		log.Printf("Failed to publish click event to Redis stream: %v", err)
+	}
+}
+
+// add queues an XADD carrying the trimming policy on cmdable.
+func (p *ClickPublisher) add(ctx context.Context, cmdable redis.Cmdable, eventJSON []byte) *redis.StringCmd {
+	args := &redis.XAddArgs{
+		Stream: p.cfg.Name,
+		Values: map[string]interface{}{"event": eventJSON},
+	}
+	if p.cfg.MaxAge > 0 {
+		args.MinID = strconv.FormatInt(time.Now().Add(-p.cfg.MaxAge).UnixMilli(), 10)
+		args.Approx = true
+	} else if p.cfg.MaxLen > 0 {
+		args.MaxLen = p.cfg.MaxLen
+		args.Approx = true
+	}
+	return cmdable.XAdd(ctx, args)
+}
+
+// Run samples the stream backlog every MonitorInterval until ctx is cancelled.
+// When the backlog is back under the high-water mark, spilled events are
+// replayed onto the stream.
+func (p *ClickPublisher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.MonitorInterval)
+	defer ticker.Stop()
+
+	for {
+		p.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *ClickPublisher) check(ctx context.Context) {
+	stats := StreamStats{
+		HighWaterMark: p.cfg.HighWaterMark,
+		Policy:        p.cfg.OverflowPolicy,
+		CheckedAt:     time.Now().UTC().Format(time.RFC3339),
+		Lag:           -1,
+	}
+
+	length, err := p.cache.XLen(ctx, p.cfg.Name).Result()
+	if err != nil {
+		log.Printf("Failed to read click stream length: %v", err)
+		return
+	}
+	stats.Length = length
+	stats.Backlog = length
+
+	groups, err := p.cache.XInfoGroups(ctx, p.cfg.Name).Result()
+	if err != nil && !isNoSuchKey(err) {
+		log.Printf("Failed to read click stream groups: %v", err)
+	}
+	for _, group := range groups {
+		if group.Name != p.cfg.Group {
+			continue
+		}
+		stats.Lag = group.Lag
+		stats.Pending = group.Pending
+		// Lag is unknown (-1) after some trims; fall back to the stream length.
+		if group.Lag >= 0 {
+			stats.Backlog = group.Lag + group.Pending
+		}
+	}
+
+	overflowing := p.cfg.HighWaterMark > 0 && stats.Backlog >= p.cfg.HighWaterMark
+	if overflowing && !p.overflowing.Load() {
+		log.Printf("Click stream backlog %d reached high-water mark %d, applying %q policy", stats.Backlog, p.cfg.HighWaterMark, p.cfg.OverflowPolicy)
+	} else if !overflowing && p.overflowing.Load() {
+		log.Printf("Click stream backlog %d back under high-water mark %d", stats.Backlog, p.cfg.HighWaterMark)
+	}
+	p.overflowing.Store(overflowing)
+
+	if !overflowing && p.spill != nil {
+		p.replaySpill(ctx)
+	}
+
+	p.mu.Lock()
+	p.stats = stats
+	p.mu.Unlock()
+}
+
+// replaySpill pushes spilled events back onto the stream in pipelined chunks.
+func (p *ClickPublisher) replaySpill(ctx context.Context) {
+	replayed, err := p.spill.Drain(func(events [][]byte) error {
+		_, err := p.cache.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, eventJSON := range events {
+				p.add(ctx, pipe, eventJSON)
+			}
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to replay spilled click events: %v", err)
+	}
+	if replayed > 0 {
+		log.Printf("Replayed %d spilled click events", replayed)
+	}
+}
+
+// Stats returns the last observed stream state along with overflow counters.
+func (p *ClickPublisher) Stats() StreamStats {
+	p.mu.Lock()
+	stats := p.stats
+	p.mu.Unlock()
+
+	stats.Overflowing = p.overflowing.Load()
+	stats.Dropped = p.dropped.Load()
+	stats.Spilled = p.spilled.Load()
+	if p.spill != nil {
+		stats.SpillPending = p.spill.Len()
+	}
+	return stats
+}
+
+// Close releases the spill file, if any. Unreplayed events stay on disk and
+// are picked up by the next process.
+func (p *ClickPublisher) Close() error {
+	if p.spill == nil {
+		return nil
+	}
+	return p.spill.Close()
+}
+
+func isNoSuchKey(err error) bool {
+	return err != nil && err.Error() == "ERR no such key"
+}
+
+// spillReplayChunk is how many spilled events are sent per pipeline.
+const spillReplayChunk = 500
+
+// spillBuffer is an append-only file of JSON encoded click events, one per line.
+type spillBuffer struct {
+	mu    sync.Mutex
+	path  string
+	file  *os.File
+	count atomic.Int64
+}
+
+func openSpillBuffer(path string) (*spillBuffer, error) {
+	if path == "" {
+		return nil, errors.New("click stream spill policy requires spill_path")
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open spill file: %w", err)
+	}
+	b := &spillBuffer{path: path, file: file}
+	b.count.Store(countLines(path) + countLines(b.replayPath()))
+	return b, nil
+}
+
+func (b *spillBuffer) replayPath() string {
+	return b.path + ".replay"
+}
+
+func (b *spillBuffer) Append(eventJSON []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := b.file.Write(append(eventJSON, '\n')); err != nil {
+		return err
+	}
+	b.count.Add(1)
+	return nil
+}
+
+func (b *spillBuffer) Len() int64 {
+	return b.count.Load()
+}
+
+// Drain hands all buffered events to publish in chunks. The current file is
+// first rotated to a ".replay" file so new events can keep spilling meanwhile.
+// If publish fails, the remaining events are kept in the replay file for the
+// next call.
+func (b *spillBuffer) Drain(publish func([][]byte) error) (int, error) {
+	if err := b.rotate(); err != nil {
+		return 0, err
+	}
+
+	data, err := os.ReadFile(b.replayPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var events [][]byte
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) > 0 {
+			events = append(events, line)
+		}
+	}
+
+	replayed := 0
+	for replayed < len(events) {
+		end := min(replayed+spillReplayChunk, len(events))
+		if err := publish(events[replayed:end]); err != nil {
+			b.count.Add(-int64(replayed))
+			if keepErr := b.keep(events[replayed:]); keepErr != nil {
+				return replayed, keepErr
+			}
+			return replayed, err
+		}
+		replayed = end
+	}
+	b.count.Add(-int64(replayed))
+	return replayed, os.Remove(b.replayPath())
+}
+
+// rotate moves the live spill file to the replay path unless a replay file is
+// still waiting from an earlier, interrupted drain.
+func (b *spillBuffer) rotate() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := os.Stat(b.replayPath()); err == nil {
+		return nil
+	}
+	info, err := b.file.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+
+	if err := b.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(b.path, b.replayPath()); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(b.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	b.file = file
+	return nil
+}
+
+// keep rewrites the replay file with the events that could not be published.
+func (b *spillBuffer) keep(events [][]byte) error {
+	var data []byte
+	for _, eventJSON := range events {
+		data = append(data, eventJSON...)
+		data = append(data, '\n')
+	}
+	return os.WriteFile(b.replayPath(), data, 0o600)
+}
+
+// countLines returns the number of events in a spill file, or 0 if it does not exist.
+func countLines(path string) int64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	return int64(bytes.Count(data, []byte("\n")))
+}
+
+func (b *spillBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.file.Close()
+}
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sumanthd032/go-shorty/internal/repositories/db"
+)
+
+// Export formats and datasets. The clicks dataset is one row per stored click;
+// the daily dataset is one row per link, UTC day and rollup dimensions.
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson"
+
+	ExportDatasetClicks = "clicks"
+	ExportDatasetDaily  = "daily"
+)
+
+// Export job statuses, as stored in export_jobs.status.
+const (
+	ExportStatusPending = "pending"
+	ExportStatusRunning = "running"
+	ExportStatusDone    = "done"
+	ExportStatusFailed  = "failed"
+)
+
+var (
+	ErrInvalidExportFormat  = errors.New("format must be one of csv, ndjson")
+	ErrInvalidExportDataset = errors.New("dataset must be one of clicks, daily")
+)
+
+var (
+	exportClickColumns = []string{
+		"link_id", "alias", "clicked_at", "ip_address", "user_agent", "referrer",
+		"referrer_domain", "browser", "os", "device_type", "country", "region",
+		"city", "is_bot", "bot_name", "is_preview",
+	}
+	exportDailyColumns = []string{
+		"link_id", "alias", "day", "country", "device_type", "referrer_domain",
+		"is_bot", "clicks", "previews",
+	}
+)
+
+// ExportRequest selects what to export. LinkID zero exports all of the user's
+// links.
+type ExportRequest struct {
+	UserID  int64
+	Dataset string
+	Format  string
+	LinkID  int64
+	From    time.Time
+	To      time.Time
+}
+
+// Validate checks the format and dataset.
+func (req ExportRequest) Validate() error {
+	if req.Format != ExportFormatCSV && req.Format != ExportFormatNDJSON {
+		return ErrInvalidExportFormat
+	}
+	if req.Dataset != ExportDatasetClicks && req.Dataset != ExportDatasetDaily {
+		return ErrInvalidExportDataset
+	}
+	return nil
+}
+
+// FileName suggests a download name such as "clicks-20260101-20260131.csv".
+func (req ExportRequest) FileName() string {
+	return fmt.Sprintf("%s-%s-%s.%s", req.Dataset, req.From.UTC().Format("20060102"), req.To.UTC().Format("20060102"), req.Format)
+}
+
+// ExportContentType returns the media type of an export format.
+func ExportContentType(format string) string {
+	if format == ExportFormatNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Exporter writes click data as CSV or NDJSON while it is read from Postgres,
+// so neither the server nor the worker holds a whole export in memory.
+type Exporter struct {
+	queries *db.Queries
+}
+
+func NewExporter(queries *db.Queries) *Exporter {
+	return &Exporter{queries: queries}
+}
+
+// Write streams the export to w and returns the number of rows written. When
+// it fails part way, w has already received the rows before the failure.
+func (e *Exporter) Write(ctx context.Context, w io.Writer, req ExportRequest) (int64, error) {
+	if err := req.Validate(); err != nil {
+		return 0, err
+	}
+
+	var enc exportEncoder
+	if req.Format == ExportFormatNDJSON {
+		enc = &ndjsonEncoder{w: bufio.NewWriter(w)}
+	} else {
+		enc = &csvEncoder{w: csv.NewWriter(w)}
+	}
+
+	userID := pgtype.Int8{Int64: req.UserID, Valid: true}
+	linkID := pgtype.Int8{Int64: req.LinkID, Valid: req.LinkID != 0}
+
+	var rows int64
+	var err error
+	switch req.Dataset {
+	case ExportDatasetClicks:
+		if err := enc.header(exportClickColumns); err != nil {
+			return 0, err
+		}
+		err = e.queries.ExportClicksEach(ctx, db.ExportClicksParams{
+			UserID:   userID,
+			LinkID:   linkID,
+			FromTime: pgtype.Timestamptz{Time: req.From, Valid: true},
+			ToTime:   pgtype.Timestamptz{Time: req.To, Valid: true},
+		}, func(row db.ExportClicksRow) error {
+			rows++
+			return enc.row([]any{
+				row.LinkID,
+				row.Alias,
+				row.ClickedAt.Time.UTC().Format(time.RFC3339Nano),
+				exportText(row.IpAddress),
+				exportText(row.UserAgent),
+				exportText(row.Referrer),
+				exportText(row.ReferrerDomain),
+				exportText(row.Browser),
+				exportText(row.Os),
+				exportText(row.DeviceType),
+				exportText(row.Country),
+				exportText(row.Region),
+				exportText(row.City),
+				row.IsBot,
+				exportText(row.BotName),
+				row.IsPreview,
+			})
+		})
+	case ExportDatasetDaily:
+		if err := enc.header(exportDailyColumns); err != nil {
+			return 0, err
+		}
+		// Rollups are kept per UTC day, so the range is widened to whole days.
+		fromDay := req.From.UTC().Truncate(24 * time.Hour)
+		toDay := req.To.UTC().Add(-time.Nanosecond).Truncate(24*time.Hour).AddDate(0, 0, 1)
+		err = e.queries.ExportDailyRollupsEach(ctx, db.ExportDailyRollupsParams{
+			UserID:  userID,
+			LinkID:  linkID,
+			FromDay: pgtype.Date{Time: fromDay, Valid: true},
+			ToDay:   pgtype.Date{Time: toDay, Valid: true},
+		}, func(row db.ExportDailyRollupsRow) error {
+			rows++
+			return enc.row([]any{
+				row.LinkID,
+				row.Alias,
+				row.Day.Time.Format(time.DateOnly),
+				row.Country,
+				row.DeviceType,
+				row.ReferrerDomain,
+				row.IsBot,
+				row.Clicks,
+				row.Previews,
+			})
+		})
+	}
+	if err != nil {
+		return rows, fmt.Errorf("could not export %s: %w", req.Dataset, err)
+	}
+	return rows, enc.flush()
+}
+
+// exportText maps NULL to nil, which is an empty CSV field or a JSON null.
+func exportText(t pgtype.Text) any {
+	if !t.Valid {
+		return nil
+	}
+	return t.String
+}
+
+type exportEncoder interface {
+	header(columns []string) error
+	row(values []any) error
+	flush() error
+}
+
+type csvEncoder struct {
+	w      *csv.Writer
+	record []string
+}
+
+func (e *csvEncoder) header(columns []string) error {
+	return e.w.Write(columns)
+}
+
+func (e *csvEncoder) row(values []any) error {
+	e.record = e.record[:0]
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			e.record = append(e.record, "")
+		case string:
+			e.record = append(e.record, csvText(v))
+		case int64:
+			e.record = append(e.record, strconv.FormatInt(v, 10))
+		case bool:
+			e.record = append(e.record, strconv.FormatBool(v))
+		default:
+			e.record = append(e.record, fmt.Sprint(v))
+		}
+	}
+	return e.w.Write(e.record)
+}
+
+// csvText neutralises strings that spreadsheets would run as formulas.
+// Referrers, user agents and locations come from visitors, so a click with a
+// Referer such as "=HYPERLINK(...)" must not become a live formula when the
+// export is opened in Excel or Sheets. Such cells get a leading quote, which
+// the spreadsheet shows as text.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func (e *csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// ndjsonEncoder writes one JSON object per line with the keys in column order.
+type ndjsonEncoder struct {
+	w       *bufio.Writer
+	columns [][]byte
+}
+
+func (e *ndjsonEncoder) header(columns []string) error {
+	e.columns = make([][]byte, len(columns))
+	for i, column := range columns {
+		key, err := json.Marshal(column)
+		if err != nil {
+			return err
+		}
+		e.columns[i] = key
+	}
+	return nil
+}
+
+func (e *ndjsonEncoder) row(values []any) error {
+	e.w.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			e.w.WriteByte(',')
+		}
+		e.w.Write(e.columns[i])
+		e.w.WriteByte(':')
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		e.w.Write(encoded)
+	}
+	e.w.WriteByte('}')
+	return e.w.WriteByte('\n')
+}
+
+func (e *ndjsonEncoder) flush() error {
+	return e.w.Flush()
+}
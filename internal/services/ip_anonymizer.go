@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// IP modes, set per deployment in config.PrivacyConfig and optionally per user.
+const (
+	IPModeFull     = "full"
+	IPModeTruncate = "truncate"
+	IPModeHash     = "hash"
+)
+
+var ErrInvalidIPMode = errors.New("ip_mode must be one of full, truncate, hash")
+
+// ipSaltTTL keeps a day's salt around long enough for late or redelivered
+// clicks of that day. Once it expires, hashes of that day can no longer be
+// linked to an address.
+const ipSaltTTL = 48 * time.Hour
+
+// ValidIPMode reports whether mode is one of the IP modes.
+func ValidIPMode(mode string) bool {
+	switch mode {
+	case IPModeFull, IPModeTruncate, IPModeHash:
+		return true
+	}
+	return false
+}
+
+// IPAnonymizer applies an IP mode to click addresses. The salt used for
+// hashing is random, shared through Redis by all workers and replaced every
+// UTC day.
+type IPAnonymizer struct {
+	cache *redis.Client
+
+	mu    sync.Mutex
+	salts map[string][]byte
+}
+
+func NewIPAnonymizer(cache *redis.Client) *IPAnonymizer {
+	return &IPAnonymizer{cache: cache, salts: make(map[string][]byte)}
+}
+
+// Anonymize returns ip as it should be stored under mode. at is the time of
+// the click and selects the salt for the hash mode.
+func (a *IPAnonymizer) Anonymize(ctx context.Context, ip, mode string, at time.Time) (string, error) {
+	switch mode {
+	case IPModeFull:
+		return ip, nil
+	case IPModeTruncate:
+		return TruncateIP(ip), nil
+	case IPModeHash:
+		if ip == "" {
+			return "", nil
+		}
+		salt, err := a.salt(ctx, at.UTC().Format("20060102"))
+		if err != nil {
+			return "", err
+		}
+		mac := hmac.New(sha256.New, salt)
+		mac.Write([]byte(ip))
+		return hex.EncodeToString(mac.Sum(nil)[:16]), nil
+	}
+	return "", ErrInvalidIPMode
+}
+
+// TruncateIP zeroes the host part of an address: IPv4 is cut to /24 and IPv6
+// to /48. Anything that is not an address is dropped.
+func TruncateIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap().WithZone("")
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.Addr().String()
+}
+
+func (a *IPAnonymizer) salt(ctx context.Context, day string) ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if salt, ok := a.salts[day]; ok {
+		return salt, nil
+	}
+
+	fresh := make([]byte, 32)
+	if _, err := rand.Read(fresh); err != nil {
+		return nil, err
+	}
+	key := "ip_salt:" + day
+	// The first worker to need a day's salt creates it; everyone else reads it.
+	if err := a.cache.SetNX(ctx, key, fresh, ipSaltTTL).Err(); err != nil {
+		return nil, fmt.Errorf("could not store IP salt: %w", err)
+	}
+	salt, err := a.cache.Get(ctx, key).Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("could not read IP salt: %w", err)
+	}
+
+	// Only the current and previous day are needed in practice; the previous
+	// day's salt is kept for clicks that arrive late.
+	if t, err := time.Parse("20060102", day); err == nil {
+		previous := t.AddDate(0, 0, -1).Format("20060102")
+		for cached := range a.salts {
+			if cached < previous {
+				delete(a.salts, cached)
+			}
+		}
+	}
+	a.salts[day] = salt
+	return salt, nil
+}
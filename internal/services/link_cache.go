@@ -0,0 +1,90 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sumanthd032/go-shorty/internal/repositories/db"
+)
+
+// linkCacheVersion prefixes every cached record. Bump it whenever the encoding
+// below changes so entries written by an older deploy are treated as misses.
+const linkCacheVersion = "v1"
+
+const (
+	cachedLinkPasswordProtected uint8 = 1 << iota
+)
+
+var errCacheFormat = errors.New("unrecognised cached link format")
+
+// cachedLink is the compact record stored under LinkCacheKey. It carries
+// everything the redirect path needs, so cache hits never touch Postgres.
+type cachedLink struct {
+	ID        int64
+	URL       string
+	ExpiresAt int64 // unix seconds, 0 means the link never expires
+	Flags     uint8
+}
+
+func newCachedLink(link db.Link) cachedLink {
+	record := cachedLink{
+		ID:  link.ID,
+		URL: link.OriginalUrl,
+	}
+	if link.ExpiresAt.Valid {
+		record.ExpiresAt = link.ExpiresAt.Time.Unix()
+	}
+	if len(link.PasswordHash) > 0 {
+		record.Flags |= cachedLinkPasswordProtected
+	}
+	return record
+}
+
+func (c cachedLink) passwordProtected() bool {
+	return c.Flags&cachedLinkPasswordProtected != 0
+}
+
+func (c cachedLink) expired(now time.Time) bool {
+	return c.ExpiresAt != 0 && now.Unix() >= c.ExpiresAt
+}
+
+// encode renders the record as "version|id|expires_at|flags|url". The URL goes
+// last because it is the only field that may itself contain a separator.
+func (c cachedLink) encode() string {
+	return strings.Join([]string{
+		linkCacheVersion,
+		strconv.FormatInt(c.ID, 10),
+		strconv.FormatInt(c.ExpiresAt, 10),
+		strconv.FormatUint(uint64(c.Flags), 10),
+		c.URL,
+	}, "|")
+}
+
+func decodeCachedLink(value string) (cachedLink, error) {
+	parts := strings.SplitN(value, "|", 5)
+	if len(parts) != 5 || parts[0] != linkCacheVersion {
+		return cachedLink{}, errCacheFormat
+	}
+
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return cachedLink{}, errCacheFormat
+	}
+	expiresAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return cachedLink{}, errCacheFormat
+	}
+	flags, err := strconv.ParseUint(parts[3], 10, 8)
+	if err != nil {
+		return cachedLink{}, errCacheFormat
+	}
+
+	return cachedLink{
+		ID:        id,
+		URL:       parts[4],
+		ExpiresAt: expiresAt,
+		Flags:     uint8(flags),
+	}, nil
+}
@@ -2,41 +2,70 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"regexp"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/redis/go-redis/v9"
+	"github.com/sumanthd032/go-shorty/internal/config"
 	"github.com/sumanthd032/go-shorty/internal/repositories/db"
 	"github.com/sumanthd032/go-shorty/pkg/utils"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var ErrAliasExists = errors.New("custom alias already exists")
 var ErrLinkNotFound = errors.New("link not found")
+var ErrPasswordRequired = errors.New("link is password protected")
+var ErrInvalidPassword = errors.New("invalid link password")
+var ErrTooManyAttempts = errors.New("too many failed password attempts")
+var ErrLinkExpired = errors.New("link has expired")
+var ErrInvalidExpiry = errors.New("expiry must be in the future")
+var ErrInvalidAlias = errors.New("alias may only contain letters, numbers, underscores and hyphens")
+var ErrLinkQuotaExceeded = errors.New("link limit reached, verify your email to create more links")
+
+// aliasPattern matches the aliases accepted by the public redirect route.
+var aliasPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// linkCacheTTL is the longest a link stays in the redirect cache. Links that
+// expire sooner are cached only for their remaining lifetime.
+const linkCacheTTL = 1 * time.Hour
+
+// LinkCacheKey is the Redis key under which a link's redirect record is cached.
+// Anything that changes or retires a link must delete this key.
+func LinkCacheKey(alias string) string {
+	return "link:" + alias
+}
 
 // This struct will be the message we send to our background worker.
 type ClickEvent struct {
-	LinkID    int64  `json:"link_id"`
+	LinkID    int64     `json:"link_id"`
 	Timestamp time.Time `json:"timestamp"`
-	IPAddress string `json:"ip_address"`
-	UserAgent string `json:"user_agent"`
-	Referrer  string `json:"referrer"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Referrer  string    `json:"referrer"`
 }
 
 type LinkService struct {
-	queries *db.Queries
-	cache   *redis.Client
+	queries   *db.Queries
+	cache     *redis.Client
+	cfg       config.LinksConfig
+	publisher *ClickPublisher
+	// pending tracks click events still being published in the background.
+	pending sync.WaitGroup
 }
 
-func NewLinkService(queries *db.Queries, cache *redis.Client) *LinkService {
+func NewLinkService(queries *db.Queries, cache *redis.Client, cfg config.LinksConfig, publisher *ClickPublisher) *LinkService {
 	return &LinkService{
-		queries: queries,
-		cache:   cache,
+		queries:   queries,
+		cache:     cache,
+		cfg:       cfg,
+		publisher: publisher,
 	}
 }
 
@@ -44,12 +73,22 @@ type CreateLinkParams struct {
 	OriginalURL string
 	CustomAlias string
 	UserID      int64
+	// Password is optional. When set, visitors must enter it before being redirected.
+	Password string
+	// ExpiresAt is optional. After this time the link answers with ErrLinkExpired.
+	ExpiresAt *time.Time
 }
 
 func (s *LinkService) Create(ctx context.Context, params CreateLinkParams) (db.Link, error) {
 	alias := params.CustomAlias
 	if alias == "" {
 		alias = utils.String()
+	} else if !aliasPattern.MatchString(alias) {
+		return db.Link{}, ErrInvalidAlias
+	}
+
+	if err := s.checkLinkQuota(ctx, params.UserID); err != nil {
+		return db.Link{}, err
 	}
 
 	createParams := db.CreateLinkParams{
@@ -61,6 +100,21 @@ func (s *LinkService) Create(ctx context.Context, params CreateLinkParams) (db.L
 		},
 	}
 
+	if params.ExpiresAt != nil {
+		if !params.ExpiresAt.After(time.Now()) {
+			return db.Link{}, ErrInvalidExpiry
+		}
+		createParams.ExpiresAt = pgtype.Timestamptz{Time: *params.ExpiresAt, Valid: true}
+	}
+
+	if params.Password != "" {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(params.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return db.Link{}, fmt.Errorf("could not hash link password: %w", err)
+		}
+		createParams.PasswordHash = hashedPassword
+	}
+
 	link, err := s.queries.CreateLink(ctx, createParams)
 	if err != nil {
 		var pgErr *pgconn.PgError
@@ -73,57 +127,265 @@ func (s *LinkService) Create(ctx context.Context, params CreateLinkParams) (db.L
 	return link, nil
 }
 
-// GetOriginalURLAndTrack finds a link's destination and publishes a click event.
-func (s *LinkService) GetOriginalURLAndTrack(ctx context.Context, alias, ip, userAgent, referrer string) (string, error) {
-	// 1. Try to get from cache first for speed.
-	originalURL, err := s.cache.Get(ctx, alias).Result()
-	if err == nil {
-		// Cache Hit. We need the link ID to track the click.
-		// Let's assume we also cache a small link object, not just the URL.
-		// For now, we'll simplify and do a DB lookup in the background.
-		go s.publishClickEvent(alias, ip, userAgent, referrer)
-		return originalURL, nil
+// checkLinkQuota returns ErrLinkQuotaExceeded if the user has not verified
+// their email and already has UnverifiedMaxLinks links.
+func (s *LinkService) checkLinkQuota(ctx context.Context, userID int64) error {
+	if s.cfg.UnverifiedMaxLinks <= 0 {
+		return nil
+	}
+	user, err := s.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if IsVerified(user) {
+		return nil
+	}
+	count, err := s.queries.CountLinksForUser(ctx, pgtype.Int8{Int64: userID, Valid: true})
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
 	}
-	if err != redis.Nil {
-		return "", fmt.Errorf("error fetching from cache: %w", err)
+	if count >= int64(s.cfg.UnverifiedMaxLinks) {
+		return ErrLinkQuotaExceeded
 	}
+	return nil
+}
 
-	// 2. Cache Miss. Get from database.
-	link, err := s.queries.GetLinkByAlias(ctx, alias)
+// UpdateLinkParams lists the fields of a link that can be changed. Nil fields
+// are left untouched.
+type UpdateLinkParams struct {
+	OriginalURL *string
+	Alias       *string
+	ExpiresAt   *time.Time
+	// ClearExpiry removes any expiry, making the link permanent again.
+	ClearExpiry bool
+	// Password replaces the link password. An empty string removes it.
+	Password *string
+}
+
+// Get returns a link owned by userID.
+func (s *LinkService) Get(ctx context.Context, id, userID int64) (db.Link, error) {
+	link, err := s.queries.GetLinkByIDForUser(ctx, db.GetLinkByIDForUserParams{
+		ID:     id,
+		UserID: pgtype.Int8{Int64: userID, Valid: true},
+	})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return "", ErrLinkNotFound
+			return db.Link{}, ErrLinkNotFound
 		}
-		return "", fmt.Errorf("database error: %w", err)
+		return db.Link{}, fmt.Errorf("database error: %w", err)
 	}
+	return link, nil
+}
 
-	// 3. Store in cache for next time.
-	err = s.cache.Set(ctx, alias, link.OriginalUrl, 1*time.Hour).Err()
+// Update applies params to a link owned by userID and evicts both the old and
+// the new alias from the redirect cache so the change takes effect immediately.
+func (s *LinkService) Update(ctx context.Context, id, userID int64, params UpdateLinkParams) (db.Link, error) {
+	link, err := s.Get(ctx, id, userID)
 	if err != nil {
-		log.Printf("Failed to cache link %s: %v", alias, err)
+		return db.Link{}, err
+	}
+
+	updateParams := db.UpdateLinkParams{
+		ID:           link.ID,
+		UserID:       link.UserID,
+		Alias:        link.Alias,
+		OriginalUrl:  link.OriginalUrl,
+		ExpiresAt:    link.ExpiresAt,
+		PasswordHash: link.PasswordHash,
+		Expired:      link.Expired,
+	}
+
+	if params.OriginalURL != nil {
+		updateParams.OriginalUrl = *params.OriginalURL
+	}
+	if params.Alias != nil {
+		if !aliasPattern.MatchString(*params.Alias) {
+			return db.Link{}, ErrInvalidAlias
+		}
+		updateParams.Alias = *params.Alias
+	}
+	if params.ClearExpiry {
+		updateParams.ExpiresAt = pgtype.Timestamptz{}
+		updateParams.Expired = false
+	} else if params.ExpiresAt != nil {
+		if !params.ExpiresAt.After(time.Now()) {
+			return db.Link{}, ErrInvalidExpiry
+		}
+		updateParams.ExpiresAt = pgtype.Timestamptz{Time: *params.ExpiresAt, Valid: true}
+		updateParams.Expired = false
+	}
+	if params.Password != nil {
+		updateParams.PasswordHash = nil
+		if *params.Password != "" {
+			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*params.Password), bcrypt.DefaultCost)
+			if err != nil {
+				return db.Link{}, fmt.Errorf("could not hash link password: %w", err)
+			}
+			updateParams.PasswordHash = hashedPassword
+		}
+	}
+
+	updated, err := s.queries.UpdateLink(ctx, updateParams)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return db.Link{}, ErrLinkNotFound
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return db.Link{}, ErrAliasExists
+		}
+		return db.Link{}, fmt.Errorf("could not update link: %w", err)
+	}
+
+	s.invalidate(ctx, link.Alias, updated.Alias)
+	if params.Password != nil {
+		// Failed guesses at the old password say nothing about the new one.
+		if err := s.cache.Del(ctx, unlockAttemptsKey(link.Alias), unlockAttemptsKey(updated.Alias)).Err(); err != nil {
+			log.Printf("Failed to reset unlock attempts for %s: %v", updated.Alias, err)
+		}
+	}
+	return updated, nil
+}
+
+// Delete removes a link owned by userID and evicts it from the redirect cache.
+func (s *LinkService) Delete(ctx context.Context, id, userID int64) error {
+	alias, err := s.queries.DeleteLink(ctx, db.DeleteLinkParams{
+		ID:     id,
+		UserID: pgtype.Int8{Int64: userID, Valid: true},
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrLinkNotFound
+		}
+		return fmt.Errorf("could not delete link: %w", err)
+	}
+
+	s.invalidate(ctx, alias)
+	return nil
+}
+
+// invalidate drops the cached redirect records for the given aliases.
+func (s *LinkService) invalidate(ctx context.Context, aliases ...string) {
+	keys := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		keys = append(keys, LinkCacheKey(alias))
+	}
+	if err := s.cache.Del(ctx, keys...).Err(); err != nil {
+		log.Printf("Failed to invalidate cached links %v: %v", aliases, err)
+	}
+}
+
+// GetOriginalURLAndTrack finds a link's destination and publishes a click event.
+// Password protected links return ErrPasswordRequired and must be opened through
+// UnlockAndTrack instead. Expired links return ErrLinkExpired.
+func (s *LinkService) GetOriginalURLAndTrack(ctx context.Context, alias, ip, userAgent, referrer string) (string, error) {
+	// 1. Try to get from cache first for speed.
+	record, found, err := s.getCachedLink(ctx, alias)
+	if err != nil {
+		return "", err
+	}
+
+	// 2. Cache Miss. Get from database and store it for next time.
+	if !found {
+		link, err := s.queries.GetLinkByAlias(ctx, alias)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return "", ErrLinkNotFound
+			}
+			return "", fmt.Errorf("database error: %w", err)
+		}
+		if isExpired(link, time.Now()) {
+			return "", ErrLinkExpired
+		}
+
+		record = newCachedLink(link)
+		s.setCachedLink(ctx, alias, record, cacheTTL(link, time.Now()))
+	}
+
+	// 3. The cached record is enough to enforce expiry and passwords.
+	if record.expired(time.Now()) {
+		return "", ErrLinkExpired
+	}
+	if record.passwordProtected() {
+		return "", ErrPasswordRequired
 	}
 
 	// 4. Publish click event in the background.
 	event := ClickEvent{
-		LinkID:    link.ID,
+		LinkID:    record.ID,
 		Timestamp: time.Now(),
 		IPAddress: ip,
 		UserAgent: userAgent,
 		Referrer:  referrer,
 	}
-	s.publishEvent(ctx, event)
+	s.publishInBackground(event)
 
-	return link.OriginalUrl, nil
+	return record.URL, nil
 }
 
-// publishClickEvent is a helper for cache hits where we don't have the link ID.
-// In a production system, you'd want to cache the link ID as well.
-func (s *LinkService) publishClickEvent(alias, ip, userAgent, referrer string) {
-	link, err := s.queries.GetLinkByAlias(context.Background(), alias)
+// getCachedLink reads the redirect record for alias. Entries written in an
+// older format are reported as not found so they get rewritten.
+func (s *LinkService) getCachedLink(ctx context.Context, alias string) (cachedLink, bool, error) {
+	value, err := s.cache.Get(ctx, LinkCacheKey(alias)).Result()
+	if err == redis.Nil {
+		return cachedLink{}, false, nil
+	}
+	if err != nil {
+		return cachedLink{}, false, fmt.Errorf("error fetching from cache: %w", err)
+	}
+
+	record, err := decodeCachedLink(value)
 	if err != nil {
-		log.Printf("Failed to get link for tracking alias %s: %v", alias, err)
+		return cachedLink{}, false, nil
+	}
+	return record, true, nil
+}
+
+func (s *LinkService) setCachedLink(ctx context.Context, alias string, record cachedLink, ttl time.Duration) {
+	// Links about to expire are not worth caching, and Redis rejects sub-millisecond TTLs.
+	if ttl < time.Second {
 		return
 	}
+	if err := s.cache.Set(ctx, LinkCacheKey(alias), record.encode(), ttl).Err(); err != nil {
+		log.Printf("Failed to cache link %s: %v", alias, err)
+	}
+}
+
+// UnlockAndTrack checks the password of a protected link and, if it matches,
+// publishes a click event and returns the destination. Attempts are counted
+// per alias in Redis and rejected with ErrTooManyAttempts once the configured
+// limit is reached within the window. Each attempt is counted before the
+// password is compared, so parallel guesses cannot all slip in under the
+// limit; a correct password gives its attempt back.
+func (s *LinkService) UnlockAndTrack(ctx context.Context, alias, password, ip, userAgent, referrer string) (string, error) {
+	link, err := s.queries.GetLinkByAlias(ctx, alias)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrLinkNotFound
+		}
+		return "", fmt.Errorf("database error: %w", err)
+	}
+
+	if isExpired(link, time.Now()) {
+		return "", ErrLinkExpired
+	}
+	if len(link.PasswordHash) > 0 {
+		attemptsKey := unlockAttemptsKey(alias)
+		attempts, err := reserveUnlockAttempt.Run(ctx, s.cache, []string{attemptsKey}, s.cfg.UnlockWindow.Milliseconds()).Int()
+		if err != nil {
+			return "", fmt.Errorf("error counting unlock attempts: %w", err)
+		}
+		if attempts > s.cfg.UnlockMaxAttempts {
+			return "", ErrTooManyAttempts
+		}
+		if err := bcrypt.CompareHashAndPassword(link.PasswordHash, []byte(password)); err != nil {
+			return "", ErrInvalidPassword
+		}
+		if err := s.cache.Decr(ctx, attemptsKey).Err(); err != nil {
+			log.Printf("Failed to release unlock attempt for %s: %v", attemptsKey, err)
+		}
+	}
+
 	event := ClickEvent{
 		LinkID:    link.ID,
 		Timestamp: time.Now(),
@@ -131,23 +393,77 @@ func (s *LinkService) publishClickEvent(alias, ip, userAgent, referrer string) {
 		UserAgent: userAgent,
 		Referrer:  referrer,
 	}
-	s.publishEvent(context.Background(), event)
+	s.publisher.Publish(ctx, event)
+
+	return link.OriginalUrl, nil
 }
 
-// publishEvent marshals the event to JSON and adds it to a Redis Stream.
-func (s *LinkService) publishEvent(ctx context.Context, event ClickEvent) {
-	eventJSON, err := json.Marshal(event)
-	if err != nil {
-		log.Printf("Failed to marshal click event: %v", err)
-		return
+// UnlockRetryAfter reports how long until a locked alias accepts passwords again.
+func (s *LinkService) UnlockRetryAfter(ctx context.Context, alias string) time.Duration {
+	ttl, err := s.cache.TTL(ctx, unlockAttemptsKey(alias)).Result()
+	if err != nil || ttl < 0 {
+		return s.cfg.UnlockWindow
 	}
+	return ttl
+}
 
-	err = s.cache.XAdd(ctx, &redis.XAddArgs{
-		Stream: "clicks_stream",
-		Values: map[string]interface{}{"event": eventJSON},
-	}).Err()
+// reserveUnlockAttempt counts an attempt and returns the count, starting the
+// window on the first one.
+var reserveUnlockAttempt = redis.NewScript(`
+local attempts = redis.call('INCR', KEYS[1])
+if redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return attempts
+`)
 
-	if err != nil {
-		log.Printf("Failed to publish click event to Redis stream: %v", err)
+func unlockAttemptsKey(alias string) string {
+	return "unlock_attempts:" + alias
+}
+
+// IsExpired reports whether the link has been marked expired or its expiry has passed.
+func IsExpired(link db.Link) bool {
+	return isExpired(link, time.Now())
+}
+
+func isExpired(link db.Link, now time.Time) bool {
+	return link.Expired || (link.ExpiresAt.Valid && !link.ExpiresAt.Time.After(now))
+}
+
+// cacheTTL clamps linkCacheTTL to the remaining lifetime of the link.
+func cacheTTL(link db.Link, now time.Time) time.Duration {
+	if !link.ExpiresAt.Valid {
+		return linkCacheTTL
+	}
+	remaining := link.ExpiresAt.Time.Sub(now)
+	if remaining < linkCacheTTL {
+		return remaining
 	}
-}
\ No newline at end of file
+	return linkCacheTTL
+}
+
+// publishInBackground publishes the event without holding up the redirect.
+// Flush waits for these goroutines during shutdown.
+func (s *LinkService) publishInBackground(event ClickEvent) {
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		s.publisher.Publish(context.Background(), event)
+	}()
+}
+
+// Flush blocks until all background click events have been published or ctx is done.
+func (s *LinkService) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("click events not flushed: %w", ctx.Err())
+	}
+}
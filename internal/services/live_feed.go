@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sumanthd032/go-shorty/internal/config"
+)
+
+var (
+	ErrTooManySubscribers = errors.New("too many live subscriptions")
+	ErrInvalidEventID     = errors.New("invalid event id")
+)
+
+// streamIDPattern matches Redis stream entry IDs such as "1724486400000-0".
+var streamIDPattern = regexp.MustCompile(`^\d+-\d+$`)
+
+// LiveClick is a stored click as pushed to live subscribers. It carries the
+// enriched fields but never the visitor's IP or User-Agent.
+type LiveClick struct {
+	LinkID         int64     `json:"link_id"`
+	ClickedAt      time.Time `json:"clicked_at"`
+	Browser        string    `json:"browser,omitempty"`
+	OS             string    `json:"os,omitempty"`
+	Device         string    `json:"device,omitempty"`
+	ReferrerDomain string    `json:"referrer_domain,omitempty"`
+	Country        string    `json:"country,omitempty"`
+	Region         string    `json:"region,omitempty"`
+	City           string    `json:"city,omitempty"`
+	IsBot          bool      `json:"is_bot"`
+	BotName        string    `json:"bot_name,omitempty"`
+	IsPreview      bool      `json:"is_preview"`
+}
+
+// LiveEvent is a LiveClick together with the ID of its stream entry, which
+// doubles as the SSE event ID.
+type LiveEvent struct {
+	ID    string
+	Click LiveClick
+}
+
+// LiveFeed fans stored clicks out to live subscribers through one short,
+// capped Redis stream per link ("live:link:{id}"). The worker publishes after
+// a batch is committed, and any server replica can read the stream, so a
+// subscriber can reconnect to another replica and resume from its last ID.
+//
+// On the server, cache should be a client used for nothing else: every open
+// feed blocks one of its connections in XREAD.
+type LiveFeed struct {
+	cache *redis.Client
+	cfg   config.LiveConfig
+
+	// active counts this process's subscriptions against MaxSubscribers.
+	active atomic.Int64
+}
+
+func NewLiveFeed(cache *redis.Client, cfg config.LiveConfig) *LiveFeed {
+	return &LiveFeed{cache: cache, cfg: cfg}
+}
+
+func LiveStreamKey(linkID int64) string {
+	return "live:link:" + strconv.FormatInt(linkID, 10)
+}
+
+func liveSubscribersKey(userID int64) string {
+	return "live:subscribers:" + strconv.FormatInt(userID, 10)
+}
+
+// Publish appends the clicks to their links' live streams. Streams of links
+// nobody watches expire after StreamTTL.
+func (f *LiveFeed) Publish(ctx context.Context, clicks []LiveClick) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+	_, err := f.cache.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, click := range clicks {
+			clickJSON, err := json.Marshal(click)
+			if err != nil {
+				return err
+			}
+			key := LiveStreamKey(click.LinkID)
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: key,
+				MaxLen: f.cfg.StreamMaxLen,
+				Approx: true,
+				Values: map[string]interface{}{"click": clickJSON},
+			})
+			pipe.Expire(ctx, key, f.cfg.StreamTTL)
+		}
+		return nil
+	})
+	return err
+}
+
+// ValidLiveEventID reports whether id can be used to resume a live feed.
+func ValidLiveEventID(id string) bool {
+	return streamIDPattern.MatchString(id)
+}
+
+// Read blocks for up to Heartbeat waiting for clicks on the link after
+// lastID. It returns no events and no error when the wait timed out.
+func (f *LiveFeed) Read(ctx context.Context, linkID int64, lastID string) ([]LiveEvent, error) {
+	if !ValidLiveEventID(lastID) {
+		return nil, ErrInvalidEventID
+	}
+
+	streams, err := f.cache.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{LiveStreamKey(linkID), lastID},
+		Count:   100,
+		Block:   f.cfg.Heartbeat,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var events []LiveEvent
+	for _, stream := range streams {
+		for _, message := range stream.Messages {
+			event := LiveEvent{ID: message.ID}
+			clickJSON, ok := message.Values["click"].(string)
+			if !ok || json.Unmarshal([]byte(clickJSON), &event.Click) != nil {
+				continue
+			}
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// LastID returns the ID of the newest entry of the link's stream, or "0-0"
+// if it is empty. New subscribers read from there instead of using "$",
+// which would skip clicks added between two reads.
+func (f *LiveFeed) LastID(ctx context.Context, linkID int64) (string, error) {
+	messages, err := f.cache.XRevRangeN(ctx, LiveStreamKey(linkID), "+", "-", 1).Result()
+	if err != nil {
+		return "", err
+	}
+	if len(messages) == 0 {
+		return "0-0", nil
+	}
+	return messages[0].ID, nil
+}
+
+// acquireSubscription registers a subscription unless the user already has
+// the maximum. Subscriptions are kept alive by heartbeats, so those of a
+// crashed replica lapse on their own.
+var acquireSubscription = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+return 1
+`)
+
+// Subscription is a slot in a user's live subscriber limit.
+type Subscription struct {
+	feed      *LiveFeed
+	key       string
+	id        string
+	refreshed time.Time
+}
+
+// Subscribe takes one of the process's MaxSubscribers slots and one of the
+// user's MaxSubscribersPerUser slots.
+func (f *LiveFeed) Subscribe(ctx context.Context, userID int64) (sub *Subscription, err error) {
+	if n := f.active.Add(1); f.cfg.MaxSubscribers > 0 && n > int64(f.cfg.MaxSubscribers) {
+		f.active.Add(-1)
+		return nil, ErrTooManySubscribers
+	}
+	defer func() {
+		if err != nil {
+			f.active.Add(-1)
+		}
+	}()
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	sub = &Subscription{feed: f, key: liveSubscribersKey(userID), id: hex.EncodeToString(buf)}
+
+	now := time.Now()
+	ok, err := acquireSubscription.Run(ctx, f.cache, []string{sub.key},
+		now.UnixMilli(),
+		f.cfg.MaxSubscribersPerUser,
+		sub.expiry(now),
+		sub.id,
+		f.leaseTTL().Milliseconds(),
+	).Int()
+	if err != nil {
+		return nil, fmt.Errorf("could not register live subscription: %w", err)
+	}
+	if ok == 0 {
+		return nil, ErrTooManySubscribers
+	}
+	sub.refreshed = now
+	return sub, nil
+}
+
+// Refresh extends the subscription's lease.
+func (s *Subscription) Refresh(ctx context.Context) error {
+	now := time.Now()
+	pipe := s.feed.cache.TxPipeline()
+	pipe.ZAddXX(ctx, s.key, redis.Z{Score: float64(s.expiry(now)), Member: s.id})
+	pipe.PExpire(ctx, s.key, s.feed.leaseTTL())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	s.refreshed = now
+	return nil
+}
+
+// KeepAlive refreshes the lease once a heartbeat has passed since the last
+// refresh. Call it after every read, whether or not it returned clicks: on a
+// busy link reads never come back empty, yet the lease still has to be kept.
+func (s *Subscription) KeepAlive(ctx context.Context) error {
+	if time.Since(s.refreshed) < s.feed.cfg.Heartbeat {
+		return nil
+	}
+	return s.Refresh(ctx)
+}
+
+// Release frees the slots.
+func (s *Subscription) Release(ctx context.Context) error {
+	s.feed.active.Add(-1)
+	return s.feed.cache.ZRem(ctx, s.key, s.id).Err()
+}
+
+func (s *Subscription) expiry(now time.Time) int64 {
+	return now.Add(s.feed.leaseTTL()).UnixMilli()
+}
+
+// leaseTTL leaves room for a missed heartbeat before a slot is considered dead.
+func (f *LiveFeed) leaseTTL() time.Duration {
+	return 3 * f.cfg.Heartbeat
+}
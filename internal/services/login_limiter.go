@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sumanthd032/go-shorty/internal/config"
+)
+
+var (
+	ErrTooManyLoginAttempts = errors.New("too many login attempts, try again later")
+	ErrTooManyRegistrations = errors.New("too many registrations, try again later")
+	ErrTooManyEmails        = errors.New("too many emails requested, try again later")
+)
+
+// RateLimitError wraps ErrTooManyLoginAttempts, ErrTooManyRegistrations or
+// ErrTooManyEmails with how long the caller has to wait.
+type RateLimitError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+// LoginLimiter throttles logins and registrations in Redis so the limits hold
+// across server replicas. Attempts are kept in sorted sets scored by time,
+// which makes every window sliding rather than fixed. Emails are hashed in
+// key names so Redis holds no addresses.
+type LoginLimiter struct {
+	cache *redis.Client
+	cfg   config.AuthConfig
+}
+
+func NewLoginLimiter(cache *redis.Client, cfg config.AuthConfig) *LoginLimiter {
+	return &LoginLimiter{cache: cache, cfg: cfg}
+}
+
+func loginIPKey(ip string) string {
+	return "login:ip:" + ip
+}
+
+func loginFailuresKey(email string) string {
+	return "login:failures:" + accountHash(email)
+}
+
+func loginLockKey(email string) string {
+	return "login:lock:" + accountHash(email)
+}
+
+func registerIPKey(ip string) string {
+	return "register:ip:" + ip
+}
+
+func accountEmailIPKey(ip string) string {
+	return "account_email:ip:" + ip
+}
+
+func accountHash(email string) string {
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(hash[:16])
+}
+
+// BeforeLogin is called before the password is checked. It returns a
+// *RateLimitError while the email is locked or the IP is over its limit, and
+// otherwise waits out the email's progressive delay. The delay applies
+// before the outcome is known, so a client cannot cut it short by giving up
+// on slow responses.
+func (l *LoginLimiter) BeforeLogin(ctx context.Context, ip, email string) error {
+	if l.lockoutAfter() > 0 {
+		lock, err := l.cache.PTTL(ctx, loginLockKey(email)).Result()
+		if err != nil {
+			return fmt.Errorf("could not check account lock: %w", err)
+		}
+		if lock > 0 {
+			return &RateLimitError{Err: ErrTooManyLoginAttempts, RetryAfter: lock}
+		}
+	}
+
+	if l.cfg.LoginIPLimit > 0 {
+		retryAfter, err := l.take(ctx, loginIPKey(ip), l.cfg.LoginIPLimit, l.cfg.LoginWindow)
+		if err != nil {
+			return err
+		}
+		if retryAfter > 0 {
+			return &RateLimitError{Err: ErrTooManyLoginAttempts, RetryAfter: retryAfter}
+		}
+	}
+
+	if l.cfg.LoginDelayAfter <= 0 || l.cfg.LoginDelay <= 0 {
+		return nil
+	}
+	failures, err := l.failures(ctx, email)
+	if err != nil {
+		return err
+	}
+	delay := l.delay(failures)
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// LoginFailed records a failed login for the email and locks it once it
+// reaches LoginLockoutAfter failures within the window.
+func (l *LoginLimiter) LoginFailed(ctx context.Context, email string) error {
+	member, err := windowMember()
+	if err != nil {
+		return err
+	}
+	err = recordLoginFailure.Run(ctx, l.cache,
+		[]string{loginFailuresKey(email), loginLockKey(email)},
+		time.Now().UnixMilli(),
+		l.cfg.LoginWindow.Milliseconds(),
+		l.lockoutAfter(),
+		l.cfg.LoginLockout.Milliseconds(),
+		member,
+	).Err()
+	if err != nil {
+		return fmt.Errorf("could not record failed login: %w", err)
+	}
+	return nil
+}
+
+// LoginSucceeded forgets the email's failures.
+func (l *LoginLimiter) LoginSucceeded(ctx context.Context, email string) error {
+	if err := l.cache.Del(ctx, loginFailuresKey(email)).Err(); err != nil {
+		return fmt.Errorf("could not reset failed logins: %w", err)
+	}
+	return nil
+}
+
+// AllowRegister counts a registration attempt from ip and returns a
+// *RateLimitError once the IP is over its limit.
+func (l *LoginLimiter) AllowRegister(ctx context.Context, ip string) error {
+	if l.cfg.RegisterIPLimit <= 0 {
+		return nil
+	}
+	retryAfter, err := l.take(ctx, registerIPKey(ip), l.cfg.RegisterIPLimit, l.cfg.RegisterWindow)
+	if err != nil {
+		return err
+	}
+	if retryAfter > 0 {
+		return &RateLimitError{Err: ErrTooManyRegistrations, RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// AllowAccountEmail counts a request from ip for a verification or password
+// reset email and returns a *RateLimitError once the IP is over its limit.
+func (l *LoginLimiter) AllowAccountEmail(ctx context.Context, ip string) error {
+	if l.cfg.AccountEmailIPLimit <= 0 {
+		return nil
+	}
+	retryAfter, err := l.take(ctx, accountEmailIPKey(ip), l.cfg.AccountEmailIPLimit, l.cfg.RegisterWindow)
+	if err != nil {
+		return err
+	}
+	if retryAfter > 0 {
+		return &RateLimitError{Err: ErrTooManyEmails, RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// ResetAccount clears the email's failures and lockout, e.g. once its owner
+// has proven control of it by resetting the password.
+func (l *LoginLimiter) ResetAccount(ctx context.Context, email string) error {
+	if err := l.cache.Del(ctx, loginFailuresKey(email), loginLockKey(email)).Err(); err != nil {
+		return fmt.Errorf("could not reset login lockout: %w", err)
+	}
+	return nil
+}
+
+// lockoutAfter is LoginLockoutAfter, or zero when lockouts are disabled.
+func (l *LoginLimiter) lockoutAfter() int {
+	if l.cfg.LoginLockout <= 0 {
+		return 0
+	}
+	return l.cfg.LoginLockoutAfter
+}
+
+// delay is the wait before the next attempt for an email with failures
+// recent failures: none up to LoginDelayAfter, then LoginDelay doubling with
+// every further failure, capped at LoginMaxDelay.
+func (l *LoginLimiter) delay(failures int64) time.Duration {
+	excess := failures - int64(l.cfg.LoginDelayAfter)
+	if excess < 0 {
+		return 0
+	}
+	delay := l.cfg.LoginDelay
+	for ; excess > 0 && delay < l.cfg.LoginMaxDelay; excess-- {
+		delay *= 2
+	}
+	return min(delay, l.cfg.LoginMaxDelay)
+}
+
+func (l *LoginLimiter) failures(ctx context.Context, email string) (int64, error) {
+	key := loginFailuresKey(email)
+	since := strconv.FormatInt(time.Now().Add(-l.cfg.LoginWindow).UnixMilli(), 10)
+	failures, err := l.cache.ZCount(ctx, key, "("+since, "+inf").Result()
+	if err != nil {
+		return 0, fmt.Errorf("could not count failed logins: %w", err)
+	}
+	return failures, nil
+}
+
+// take adds an attempt to the sliding window at key unless it already holds
+// limit attempts, in which case it returns how long until the oldest one
+// leaves the window.
+func (l *LoginLimiter) take(ctx context.Context, key string, limit int, window time.Duration) (time.Duration, error) {
+	member, err := windowMember()
+	if err != nil {
+		return 0, err
+	}
+	retryAfter, err := takeFromWindow.Run(ctx, l.cache, []string{key},
+		time.Now().UnixMilli(),
+		window.Milliseconds(),
+		limit,
+		member,
+	).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("could not check rate limit: %w", err)
+	}
+	return time.Duration(retryAfter) * time.Millisecond, nil
+}
+
+// windowMember returns a unique sorted set member for one attempt.
+func windowMember() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// takeFromWindow drops attempts older than the window and adds one unless the
+// limit is reached. It returns 0, or the milliseconds until a slot frees up.
+var takeFromWindow = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[3]) then
+	local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+	return math.max(tonumber(oldest[2]) + window - now, 1)
+end
+redis.call('ZADD', KEYS[1], now, ARGV[4])
+redis.call('PEXPIRE', KEYS[1], window)
+return 0
+`)
+
+// recordLoginFailure adds a failure to the window and, once there are
+// lockout_after of them, sets the lock and starts counting afresh.
+var recordLoginFailure = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local lockout_after = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+redis.call('ZADD', KEYS[1], now, ARGV[5])
+redis.call('PEXPIRE', KEYS[1], window)
+if lockout_after > 0 and redis.call('ZCARD', KEYS[1]) >= lockout_after then
+	redis.call('SET', KEYS[2], '1', 'PX', ARGV[4])
+	redis.call('DEL', KEYS[1])
+end
+return 0
+`)
@@ -0,0 +1,384 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+	"github.com/sumanthd032/go-shorty/internal/config"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+var errSessionMissing = errors.New("session missing or expired")
+
+// sessionLastSeenPrecision is how stale a session's last_seen may get, and
+// with it how late the idle timeout may be extended. Without it every
+// request would rewrite the session.
+const sessionLastSeenPrecision = time.Minute
+
+// sessionRecord is what is kept in Redis for a session. Values are the
+// gorilla session values, so they must be gob-encodable.
+type sessionRecord struct {
+	UserID    int64
+	Values    map[interface{}]interface{}
+	CreatedAt time.Time
+	LastSeen  time.Time
+	IP        string
+	UserAgent string
+}
+
+// SessionInfo describes one of a user's sessions. ID is a hash of the
+// session's secret, safe to show and to use for revoking it.
+type SessionInfo struct {
+	ID        string
+	CreatedAt time.Time
+	LastSeen  time.Time
+	ExpiresAt time.Time
+	IP        string
+	UserAgent string
+}
+
+// SessionStore is a sessions.Store that keeps sessions in Redis, so they can
+// be listed and revoked server-side. The cookie only carries a signed random
+// token; Redis holds the session under "session:{sha256(token)}" and each
+// user's sessions are indexed in the sorted set "sessions:user:{id}", scored
+// by their absolute expiry.
+type SessionStore struct {
+	cache    *redis.Client
+	cfg      config.AuthConfig
+	codec    *securecookie.SecureCookie
+	clientIP func(*http.Request) string
+	// Options is the default for new sessions' cookies. MaxAge is ignored:
+	// cookies live as long as the session may.
+	Options *sessions.Options
+}
+
+// NewSessionStore creates the store. clientIP resolves the address recorded
+// for a new session.
+func NewSessionStore(cache *redis.Client, cfg config.AuthConfig, clientIP func(*http.Request) string) *SessionStore {
+	return &SessionStore{
+		cache: cache,
+		cfg:   cfg,
+		// Expiry is enforced in Redis, not by the cookie's signed timestamp.
+		codec:    securecookie.New([]byte(cfg.SessionKey), nil).MaxAge(0),
+		clientIP: clientIP,
+		Options: &sessions.Options{
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+	}
+}
+
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+func userSessionsKey(userID int64) string {
+	return "sessions:user:" + strconv.FormatInt(userID, 10)
+}
+
+// sessionID is the ID a session's token is stored under.
+func sessionID(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// CurrentSessionID returns the ID of session, or "" for a session that was
+// never saved.
+func CurrentSessionID(session *sessions.Session) string {
+	if session.ID == "" {
+		return ""
+	}
+	return sessionID(session.ID)
+}
+
+// Get returns the named session, cached for the rest of the request.
+func (s *SessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session named by the request's cookie. A missing, forged or
+// expired cookie gives an empty new session without an error; only Redis
+// failures are returned.
+func (s *SessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	var token string
+	if err := s.codec.Decode(name, cookie.Value, &token); err != nil {
+		return session, nil
+	}
+
+	record, err := s.load(r.Context(), sessionID(token))
+	if err != nil {
+		if errors.Is(err, errSessionMissing) {
+			return session, nil
+		}
+		return session, err
+	}
+	if time.Since(record.LastSeen) > sessionLastSeenPrecision {
+		if err := s.touch(r.Context(), sessionID(token), record); err != nil {
+			log.Printf("Failed to record use of session: %v", err)
+		}
+	}
+
+	session.ID = token
+	session.Values = record.Values
+	session.IsNew = false
+	return session, nil
+}
+
+// Save stores the session and sets its cookie. A negative MaxAge deletes it.
+// A session whose user changes, as at login, gets a new token so a cookie
+// planted before login cannot be used to ride on it.
+func (s *SessionStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	ctx := r.Context()
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			userID, _ := session.Values["user_id"].(int64)
+			if err := s.delete(ctx, userID, sessionID(session.ID)); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	userID, _ := session.Values["user_id"].(int64)
+	now := time.Now()
+	record := sessionRecord{
+		UserID:    userID,
+		Values:    session.Values,
+		CreatedAt: now,
+		LastSeen:  now,
+		IP:        s.clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+	if session.ID != "" {
+		existing, err := s.load(ctx, sessionID(session.ID))
+		switch {
+		case err == nil && existing.UserID == userID:
+			record.CreatedAt = existing.CreatedAt
+			record.IP = existing.IP
+			record.UserAgent = existing.UserAgent
+		case err == nil:
+			if err := s.delete(ctx, existing.UserID, sessionID(session.ID)); err != nil {
+				return err
+			}
+			session.ID = ""
+		case errors.Is(err, errSessionMissing):
+			session.ID = ""
+		default:
+			return err
+		}
+	}
+	if session.ID == "" {
+		token := make([]byte, 32)
+		if _, err := rand.Read(token); err != nil {
+			return fmt.Errorf("could not generate session token: %w", err)
+		}
+		session.ID = base64.RawURLEncoding.EncodeToString(token)
+	}
+
+	if err := s.write(ctx, sessionID(session.ID), record); err != nil {
+		return err
+	}
+	encoded, err := s.codec.Encode(session.Name(), session.ID)
+	if err != nil {
+		return fmt.Errorf("could not encode session cookie: %w", err)
+	}
+	opts := *session.Options
+	opts.MaxAge = int(time.Until(s.expiresAt(record)).Seconds())
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, &opts))
+	return nil
+}
+
+// List returns the user's active sessions, most recently used first.
+func (s *SessionStore) List(ctx context.Context, userID int64) ([]SessionInfo, error) {
+	ids, err := s.userSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]SessionInfo, 0, len(ids))
+	for _, id := range ids {
+		record, err := s.load(ctx, id)
+		if err != nil {
+			if errors.Is(err, errSessionMissing) {
+				// Expired for idleness; drop it from the index too.
+				s.cache.ZRem(ctx, userSessionsKey(userID), id)
+				continue
+			}
+			return nil, err
+		}
+		infos = append(infos, SessionInfo{
+			ID:        id,
+			CreatedAt: record.CreatedAt,
+			LastSeen:  record.LastSeen,
+			ExpiresAt: s.expiresAt(record),
+			IP:        record.IP,
+			UserAgent: record.UserAgent,
+		})
+	}
+	slices.SortFunc(infos, func(a, b SessionInfo) int {
+		return b.LastSeen.Compare(a.LastSeen)
+	})
+	return infos, nil
+}
+
+// Revoke ends one of the user's sessions.
+func (s *SessionStore) Revoke(ctx context.Context, userID int64, id string) error {
+	_, err := s.cache.ZScore(ctx, userSessionsKey(userID), id).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return ErrSessionNotFound
+		}
+		return fmt.Errorf("could not look up session: %w", err)
+	}
+	return s.delete(ctx, userID, id)
+}
+
+// RevokeAll ends all of the user's sessions except the one with ID except,
+// which may be empty. It returns how many were ended.
+func (s *SessionStore) RevokeAll(ctx context.Context, userID int64, except string) (int, error) {
+	ids, err := s.userSessions(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	revoked := 0
+	for _, id := range ids {
+		if id == except {
+			continue
+		}
+		if err := s.delete(ctx, userID, id); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+// userSessions returns the IDs in the user's index, pruning those past their
+// absolute expiry.
+func (s *SessionStore) userSessions(ctx context.Context, userID int64) ([]string, error) {
+	key := userSessionsKey(userID)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	if err := s.cache.ZRemRangeByScore(ctx, key, "-inf", "("+now).Err(); err != nil {
+		return nil, fmt.Errorf("could not prune sessions: %w", err)
+	}
+	ids, err := s.cache.ZRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("could not list sessions: %w", err)
+	}
+	return ids, nil
+}
+
+func (s *SessionStore) load(ctx context.Context, id string) (sessionRecord, error) {
+	data, err := s.cache.Get(ctx, sessionKey(id)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return sessionRecord{}, errSessionMissing
+		}
+		return sessionRecord{}, fmt.Errorf("could not load session: %w", err)
+	}
+	var record sessionRecord
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&record); err != nil {
+		// Written by an incompatible deploy; the user logs in again.
+		return sessionRecord{}, errSessionMissing
+	}
+	if !time.Now().Before(s.expiresAt(record)) {
+		return sessionRecord{}, errSessionMissing
+	}
+	return record, nil
+}
+
+// write stores the record and adds it to its user's index.
+func (s *SessionStore) write(ctx context.Context, id string, record sessionRecord) error {
+	data, ttl, err := s.encode(record)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := s.expiresAt(record)
+	pipe := s.cache.TxPipeline()
+	pipe.Set(ctx, sessionKey(id), data, ttl)
+	if record.UserID != 0 {
+		key := userSessionsKey(record.UserID)
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(expiresAt.Unix()), Member: id})
+		// The index lives as long as its longest-lived session.
+		pipe.ExpireNX(ctx, key, time.Until(expiresAt))
+		pipe.ExpireGT(ctx, key, time.Until(expiresAt))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("could not save session: %w", err)
+	}
+	return nil
+}
+
+// touch records that the session was used and restarts its idle timeout. It
+// never recreates a session that was revoked since it was loaded.
+func (s *SessionStore) touch(ctx context.Context, id string, record sessionRecord) error {
+	record.LastSeen = time.Now()
+	data, ttl, err := s.encode(record)
+	if err != nil {
+		return err
+	}
+	if err := s.cache.SetXX(ctx, sessionKey(id), data, ttl).Err(); err != nil {
+		return fmt.Errorf("could not save session: %w", err)
+	}
+	return nil
+}
+
+// encode returns the stored form of the record and how long to keep it:
+// until whichever of the idle and absolute timeouts comes first.
+func (s *SessionStore) encode(record sessionRecord) ([]byte, time.Duration, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(record); err != nil {
+		return nil, 0, fmt.Errorf("could not encode session: %w", err)
+	}
+	ttl := min(s.cfg.SessionIdleTimeout, time.Until(s.expiresAt(record)))
+	if ttl <= 0 {
+		return nil, 0, errSessionMissing
+	}
+	return buf.Bytes(), ttl, nil
+}
+
+// delete removes a session and its entry in the owner's index.
+func (s *SessionStore) delete(ctx context.Context, userID int64, id string) error {
+	pipe := s.cache.TxPipeline()
+	pipe.Del(ctx, sessionKey(id))
+	if userID != 0 {
+		pipe.ZRem(ctx, userSessionsKey(userID), id)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("could not delete session: %w", err)
+	}
+	return nil
+}
+
+// expiresAt is the session's absolute expiry.
+func (s *SessionStore) expiresAt(record sessionRecord) time.Time {
+	return record.CreatedAt.Add(s.cfg.SessionMaxAge)
+}
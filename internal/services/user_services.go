@@ -3,20 +3,78 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sumanthd032/go-shorty/internal/config"
 	"github.com/sumanthd032/go-shorty/internal/repositories/db"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrIncorrectPassword  = errors.New("current password is incorrect")
+	ErrWeakPassword       = errors.New("password must be at least 8 characters")
+	ErrAlreadyVerified    = errors.New("email is already verified")
+)
+
+// mailTimeout bounds sending one account email in the background.
+const mailTimeout = 30 * time.Second
+
 type UserService struct {
-	queries *db.Queries
+	queries  *db.Queries
+	privacy  config.PrivacyConfig
+	sessions *SessionStore
+	limiter  *LoginLimiter
+	tokens   *AccountTokens
+	mailer   Mailer
+	// baseURL prefixes the links in account emails.
+	baseURL string
+	// dummyHash is compared against when a login names an unknown email, so
+	// that it takes as long as a wrong password for a real account.
+	dummyHash []byte
+
+	// pending tracks emails being sent in the background; Flush waits for
+	// them and, if it gives up, cancels them through background.
+	pending          sync.WaitGroup
+	background       context.Context
+	cancelBackground context.CancelFunc
 }
 
-func NewUserService(queries *db.Queries) *UserService {
-	return &UserService{queries: queries}
+func NewUserService(queries *db.Queries, privacy config.PrivacyConfig, sessions *SessionStore, limiter *LoginLimiter, tokens *AccountTokens, mailer Mailer, baseURL string) *UserService {
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("go-shorty dummy password"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(fmt.Sprintf("could not hash dummy password: %v", err))
+	}
+	background, cancelBackground := context.WithCancel(context.Background())
+	return &UserService{
+		queries:          queries,
+		privacy:          privacy,
+		sessions:         sessions,
+		limiter:          limiter,
+		tokens:           tokens,
+		mailer:           mailer,
+		baseURL:          strings.TrimRight(baseURL, "/"),
+		dummyHash:        dummyHash,
+		background:       background,
+		cancelBackground: cancelBackground,
+	}
 }
 
-func (s *UserService) Register(ctx context.Context, email, password string) (db.User, error) {
+// Register creates an unverified account and emails a verification link.
+// Attempts are rate limited per IP.
+func (s *UserService) Register(ctx context.Context, ip, email, password string) (db.User, error) {
+	if err := s.limiter.AllowRegister(ctx, ip); err != nil {
+		return db.User{}, err
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return db.User{}, fmt.Errorf("could not hash password: %w", err)
@@ -32,18 +90,263 @@ func (s *UserService) Register(ctx context.Context, email, password string) (db.
 		// You'd check for specific DB errors here, e.g., duplicate email
 		return db.User{}, fmt.Errorf("could not create user: %w", err)
 	}
+	s.sendInBackground("verification", func(ctx context.Context) error {
+		return s.sendVerification(ctx, user)
+	})
 	return user, nil
 }
 
-func (s *UserService) Login(ctx context.Context, email, password string) (db.User, error) {
+// Login checks the credentials. It is throttled per IP and per email; an
+// unknown email is throttled, timed and answered exactly like a wrong
+// password, so responses do not reveal which emails have accounts.
+func (s *UserService) Login(ctx context.Context, ip, email, password string) (db.User, error) {
+	if err := s.limiter.BeforeLogin(ctx, ip, email); err != nil {
+		return db.User{}, err
+	}
+
+	hash := s.dummyHash
 	user, err := s.queries.GetUserByEmail(ctx, email)
+	if err == nil {
+		hash = user.PasswordHash
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return db.User{}, fmt.Errorf("could not get user: %w", err)
+	}
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || err != nil {
+		if err := s.limiter.LoginFailed(ctx, email); err != nil {
+			log.Printf("Failed to record failed login: %v", err)
+		}
+		return db.User{}, ErrInvalidCredentials
+	}
+	if err := s.limiter.LoginSucceeded(ctx, email); err != nil {
+		log.Printf("Failed to reset failed logins: %v", err)
+	}
+	return user, nil
+}
+
+// ChangePassword replaces the user's password after checking the current one,
+// then ends all of the user's sessions. The check is throttled like a login,
+// so a stolen session cannot be used to guess the current password.
+func (s *UserService) ChangePassword(ctx context.Context, ip string, userID int64, current, password string) error {
+	user, err := s.queries.GetUserByID(ctx, userID)
 	if err != nil {
-		return db.User{}, fmt.Errorf("invalid credentials")
+		return fmt.Errorf("could not get user: %w", err)
+	}
+	if err := s.limiter.BeforeLogin(ctx, ip, user.Email); err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(current)); err != nil {
+		if err := s.limiter.LoginFailed(ctx, user.Email); err != nil {
+			log.Printf("Failed to record failed password check: %v", err)
+		}
+		return ErrIncorrectPassword
+	}
+	if err := s.limiter.LoginSucceeded(ctx, user.Email); err != nil {
+		log.Printf("Failed to reset failed logins: %v", err)
+	}
+	if len(password) < 8 {
+		return ErrWeakPassword
 	}
 
-	err = bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(password))
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("could not hash password: %w", err)
+	}
+	err = s.queries.UpdateUserPassword(ctx, db.UpdateUserPasswordParams{ID: userID, PasswordHash: hashedPassword})
+	if err != nil {
+		return fmt.Errorf("could not update password: %w", err)
+	}
+
+	if _, err := s.sessions.RevokeAll(ctx, userID, ""); err != nil {
+		return fmt.Errorf("could not revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// IsVerified reports whether the user has verified their email.
+func IsVerified(user db.User) bool {
+	return user.EmailVerifiedAt.Valid
+}
+
+// ResendVerification emails the user a new verification link, invalidating
+// earlier ones. Requests are rate limited per IP.
+func (s *UserService) ResendVerification(ctx context.Context, ip string, userID int64) error {
+	user, err := s.queries.GetUserByID(ctx, userID)
 	if err != nil {
-		return db.User{}, fmt.Errorf("invalid credentials")
+		return fmt.Errorf("could not get user: %w", err)
+	}
+	if IsVerified(user) {
+		return ErrAlreadyVerified
+	}
+	if err := s.limiter.AllowAccountEmail(ctx, ip); err != nil {
+		return err
+	}
+	return s.sendVerification(ctx, user)
+}
+
+// VerifyEmail marks the email of the token's user as verified.
+func (s *UserService) VerifyEmail(ctx context.Context, token string) error {
+	userID, err := s.tokens.Consume(ctx, token, TokenPurposeVerifyEmail)
+	if err != nil {
+		return err
+	}
+	if err := s.queries.MarkUserEmailVerified(ctx, userID); err != nil {
+		return fmt.Errorf("could not verify email: %w", err)
+	}
+	return nil
+}
+
+// RequestPasswordReset emails a password reset link if the email belongs to
+// an account. It succeeds either way, and the email is sent in the
+// background, so neither the response nor its timing reveals whether the
+// account exists. Requests are rate limited per IP.
+func (s *UserService) RequestPasswordReset(ctx context.Context, ip, email string) error {
+	if err := s.limiter.AllowAccountEmail(ctx, ip); err != nil {
+		return err
+	}
+	user, err := s.queries.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("could not get user: %w", err)
+	}
+	s.sendInBackground("password reset", func(ctx context.Context) error {
+		token, err := s.tokens.Issue(ctx, user.ID, TokenPurposeResetPassword)
+		if err != nil {
+			return err
+		}
+		return s.mailer.Send(ctx, Message{
+			To:      user.Email,
+			Subject: "Reset your Go-Shorty password",
+			Body: fmt.Sprintf("Someone asked to reset the password of your Go-Shorty account. To choose a new password, open:\n\n%s\n\nThe link works once and expires in %s. If you did not ask for this, you can ignore this email.\n",
+				s.accountLink("/reset-password.html", token), formatTTL(s.tokens.TTL(TokenPurposeResetPassword))),
+		})
+	})
+	return nil
+}
+
+// ResetPassword sets a new password with a token from a reset email. As with
+// ChangePassword, all of the user's sessions end. The reset also proves
+// control of the email, so it verifies it and lifts any login lockout.
+func (s *UserService) ResetPassword(ctx context.Context, token, password string) error {
+	if len(password) < 8 {
+		return ErrWeakPassword
+	}
+	userID, err := s.tokens.Consume(ctx, token, TokenPurposeResetPassword)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("could not hash password: %w", err)
+	}
+	err = s.queries.UpdateUserPassword(ctx, db.UpdateUserPasswordParams{ID: userID, PasswordHash: hashedPassword})
+	if err != nil {
+		return fmt.Errorf("could not update password: %w", err)
+	}
+	if err := s.queries.MarkUserEmailVerified(ctx, userID); err != nil {
+		return fmt.Errorf("could not verify email: %w", err)
+	}
+	if _, err := s.sessions.RevokeAll(ctx, userID, ""); err != nil {
+		return fmt.Errorf("could not revoke sessions: %w", err)
+	}
+
+	user, err := s.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("could not get user: %w", err)
+	}
+	if err := s.limiter.ResetAccount(ctx, user.Email); err != nil {
+		log.Printf("Failed to lift login lockout after password reset: %v", err)
+	}
+	return nil
+}
+
+func (s *UserService) sendVerification(ctx context.Context, user db.User) error {
+	token, err := s.tokens.Issue(ctx, user.ID, TokenPurposeVerifyEmail)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, Message{
+		To:      user.Email,
+		Subject: "Verify your Go-Shorty email",
+		Body: fmt.Sprintf("Welcome to Go-Shorty! To verify your email address, open:\n\n%s\n\nThe link expires in %s. If you did not create an account, you can ignore this email.\n",
+			s.accountLink("/verify.html", token), formatTTL(s.tokens.TTL(TokenPurposeVerifyEmail))),
+	})
+}
+
+// sendInBackground sends an account email without holding up the request.
+// Flush waits for these goroutines during shutdown.
+func (s *UserService) sendInBackground(kind string, send func(ctx context.Context) error) {
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		ctx, cancel := context.WithTimeout(s.background, mailTimeout)
+		defer cancel()
+		if err := send(ctx); err != nil {
+			log.Printf("Failed to send %s email: %v", kind, err)
+		}
+	}()
+}
+
+// Flush blocks until all background emails have been sent or ctx is done, in
+// which case the emails still in flight are cancelled.
+func (s *UserService) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.cancelBackground()
+		return fmt.Errorf("account emails not sent: %w", ctx.Err())
+	}
+}
+
+func (s *UserService) accountLink(page, token string) string {
+	return s.baseURL + page + "?token=" + url.QueryEscape(token)
+}
+
+// formatTTL renders a token lifetime for an email, e.g. "48 hours".
+func formatTTL(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		if d == time.Hour {
+			return "1 hour"
+		}
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	case d >= time.Minute && d%time.Minute == 0:
+		return fmt.Sprintf("%d minutes", d/time.Minute)
+	}
+	return d.String()
+}
+
+// SetIPMode sets how the IPs of clicks on the user's links are stored. An
+// empty mode falls back to the deployment default.
+func (s *UserService) SetIPMode(ctx context.Context, userID int64, mode string) (db.User, error) {
+	if mode != "" && !ValidIPMode(mode) {
+		return db.User{}, ErrInvalidIPMode
+	}
+
+	user, err := s.queries.UpdateUserIPMode(ctx, db.UpdateUserIPModeParams{
+		ID:     userID,
+		IpMode: pgtype.Text{String: mode, Valid: mode != ""},
+	})
+	if err != nil {
+		return db.User{}, fmt.Errorf("could not update ip mode: %w", err)
 	}
 	return user, nil
-}
\ No newline at end of file
+}
+
+// EffectiveIPMode is the IP mode applied to clicks on the user's links.
+func (s *UserService) EffectiveIPMode(user db.User) string {
+	if user.IpMode.Valid {
+		return user.IpMode.String
+	}
+	return s.privacy.IPMode
+}
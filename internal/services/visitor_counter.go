@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	"github.com/sumanthd032/go-shorty/internal/repositories/db"
+)
+
+// visitorDirtyKey is a set of "linkID:YYYYMMDD" members whose HyperLogLog has
+// changed since it was last copied to Postgres.
+const visitorDirtyKey = "hll:dirty"
+
+const visitorDayLayout = "20060102"
+
+// maxVisitorDays bounds the number of daily keys merged for one count.
+const maxVisitorDays = 366
+
+// visitorPersistChunk is how many dirty keys are taken from the set at once.
+const visitorPersistChunk = 500
+
+var ErrVisitorRangeTooLarge = fmt.Errorf("unique visitors can be counted over at most %d days", maxVisitorDays)
+
+// Visit is a click to be counted towards a link's unique visitors.
+type Visit struct {
+	LinkID      int64
+	At          time.Time
+	Fingerprint string
+}
+
+// VisitorCounter counts unique visitors per link with one HyperLogLog per
+// link and UTC day in Redis ("hll:link:{id}:{YYYYMMDD}"). Keys expire after
+// ttl; their contents are copied to Postgres by Persist and merged back into
+// Redis whenever a count needs a key that is no longer there.
+type VisitorCounter struct {
+	cache   *redis.Client
+	queries *db.Queries
+	ttl     time.Duration
+}
+
+func NewVisitorCounter(cache *redis.Client, queries *db.Queries, ttl time.Duration) *VisitorCounter {
+	return &VisitorCounter{cache: cache, queries: queries, ttl: ttl}
+}
+
+// VisitorKey is the HyperLogLog key of a link on the UTC day of t.
+func VisitorKey(linkID int64, t time.Time) string {
+	return "hll:link:" + strconv.FormatInt(linkID, 10) + ":" + t.UTC().Format(visitorDayLayout)
+}
+
+// VisitorFingerprint identifies a visitor by IP address and User-Agent.
+func VisitorFingerprint(ip, userAgent string) string {
+	sum := sha256.Sum256([]byte(ip + "\x00" + userAgent))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Track adds the visits to their daily HyperLogLogs. Adding the same visit
+// twice has no effect, so redelivered clicks are not counted again.
+func (c *VisitorCounter) Track(ctx context.Context, visits []Visit) error {
+	if len(visits) == 0 {
+		return nil
+	}
+	_, err := c.cache.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, visit := range visits {
+			key := VisitorKey(visit.LinkID, visit.At)
+			pipe.PFAdd(ctx, key, visit.Fingerprint)
+			pipe.Expire(ctx, key, c.ttl)
+			pipe.SAdd(ctx, visitorDirtyKey, dirtyMember(visit.LinkID, visit.At))
+		}
+		return nil
+	})
+	return err
+}
+
+// Count returns the estimated unique visitors of each link between from and
+// to. Whole UTC days are counted, so the range is widened to day boundaries.
+func (c *VisitorCounter) Count(ctx context.Context, linkIDs []int64, from, to time.Time) (map[int64]int64, error) {
+	counts := make(map[int64]int64, len(linkIDs))
+	if len(linkIDs) == 0 {
+		return counts, nil
+	}
+
+	days := visitorDays(from, to)
+	if len(days) > maxVisitorDays {
+		return nil, ErrVisitorRangeTooLarge
+	}
+	if err := c.restore(ctx, linkIDs, days); err != nil {
+		return nil, err
+	}
+
+	cmds := make(map[int64]*redis.IntCmd, len(linkIDs))
+	_, err := c.cache.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, linkID := range linkIDs {
+			keys := make([]string, 0, len(days))
+			for _, day := range days {
+				keys = append(keys, VisitorKey(linkID, day))
+			}
+			// PFCOUNT over several keys counts their union.
+			cmds[linkID] = pipe.PFCount(ctx, keys...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not count unique visitors: %w", err)
+	}
+	for linkID, cmd := range cmds {
+		counts[linkID] = cmd.Val()
+	}
+	return counts, nil
+}
+
+// restore merges persisted sketches back into Redis for keys that have been
+// evicted or have expired.
+func (c *VisitorCounter) restore(ctx context.Context, linkIDs []int64, days []time.Time) error {
+	exists := make(map[string]*redis.IntCmd, len(linkIDs)*len(days))
+	_, err := c.cache.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, linkID := range linkIDs {
+			for _, day := range days {
+				key := VisitorKey(linkID, day)
+				exists[key] = pipe.Exists(ctx, key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not check visitor keys: %w", err)
+	}
+
+	missing := false
+	for _, cmd := range exists {
+		if cmd.Val() == 0 {
+			missing = true
+			break
+		}
+	}
+	if !missing {
+		return nil
+	}
+
+	sketches, err := c.queries.GetVisitorSketches(ctx, db.GetVisitorSketchesParams{
+		LinkIds: linkIDs,
+		FromDay: pgtype.Date{Time: days[0], Valid: true},
+		ToDay:   pgtype.Date{Time: days[len(days)-1], Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("could not load visitor sketches: %w", err)
+	}
+	for _, sketch := range sketches {
+		key := VisitorKey(sketch.LinkID, sketch.Day.Time)
+		if cmd, ok := exists[key]; !ok || cmd.Val() != 0 {
+			continue
+		}
+		if err := c.merge(ctx, key, sketch.Sketch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge unions a persisted sketch into key. Merging rather than overwriting
+// keeps visits added after the key was evicted.
+func (c *VisitorCounter) merge(ctx context.Context, key string, sketch []byte) error {
+	tmp := key + ":restore"
+	_, err := c.cache.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, tmp, sketch, time.Minute)
+		pipe.PFMerge(ctx, key, tmp)
+		pipe.Expire(ctx, key, c.ttl)
+		pipe.Del(ctx, tmp)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not restore visitor sketch %s: %w", key, err)
+	}
+	return nil
+}
+
+// Persist copies every HyperLogLog that changed since the last call to
+// Postgres and returns how many were saved.
+func (c *VisitorCounter) Persist(ctx context.Context) (int, error) {
+	saved := 0
+	for {
+		members, err := c.cache.SPopN(ctx, visitorDirtyKey, visitorPersistChunk).Result()
+		if err != nil {
+			return saved, fmt.Errorf("could not read dirty visitor keys: %w", err)
+		}
+		if len(members) == 0 {
+			return saved, nil
+		}
+
+		for i, member := range members {
+			if err := c.persist(ctx, member); err != nil {
+				// Put back whatever was not saved so the next run retries it.
+				c.cache.SAdd(ctx, visitorDirtyKey, members[i:])
+				return saved, err
+			}
+			saved++
+		}
+	}
+}
+
+func (c *VisitorCounter) persist(ctx context.Context, member string) error {
+	linkID, day, err := parseDirtyMember(member)
+	if err != nil {
+		return nil
+	}
+	key := VisitorKey(linkID, day)
+	date := pgtype.Date{Time: day, Valid: true}
+
+	// If the key was evicted and recreated since the last save, the stored
+	// sketch holds visits the key no longer has.
+	stored, err := c.queries.GetVisitorSketch(ctx, db.GetVisitorSketchParams{LinkID: linkID, Day: date})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("could not load visitor sketch: %w", err)
+	}
+	if len(stored) > 0 {
+		if err := c.merge(ctx, key, stored); err != nil {
+			return err
+		}
+	}
+
+	sketch, err := c.cache.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read visitor key: %w", err)
+	}
+
+	err = c.queries.UpsertVisitorSketch(ctx, db.UpsertVisitorSketchParams{LinkID: linkID, Day: date, Sketch: sketch})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		// The link has been deleted.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not save visitor sketch: %w", err)
+	}
+	return nil
+}
+
+func dirtyMember(linkID int64, t time.Time) string {
+	return strconv.FormatInt(linkID, 10) + ":" + t.UTC().Format(visitorDayLayout)
+}
+
+func parseDirtyMember(member string) (int64, time.Time, error) {
+	id, day, ok := strings.Cut(member, ":")
+	if !ok {
+		return 0, time.Time{}, fmt.Errorf("invalid visitor key %q", member)
+	}
+	linkID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	t, err := time.Parse(visitorDayLayout, day)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return linkID, t, nil
+}
+
+// visitorDays lists the UTC days overlapping [from, to).
+func visitorDays(from, to time.Time) []time.Time {
+	first := from.UTC().Truncate(24 * time.Hour)
+	last := to.UTC().Add(-time.Nanosecond).Truncate(24 * time.Hour)
+	var days []time.Time
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+		if len(days) > maxVisitorDays {
+			break
+		}
+	}
+	return days
+}
@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE links
+ADD COLUMN expired BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_links_expires_at ON links(expires_at) WHERE expires_at IS NOT NULL AND NOT expired;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_links_expires_at;
+
+ALTER TABLE links
+DROP COLUMN IF EXISTS expired;
@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE clicks
+ADD COLUMN browser TEXT,
+ADD COLUMN os TEXT,
+ADD COLUMN device_type TEXT,
+ADD COLUMN referrer_domain TEXT;
+
+CREATE INDEX idx_clicks_link_id_clicked_at ON clicks(link_id, clicked_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_clicks_link_id_clicked_at;
+
+ALTER TABLE clicks
+DROP COLUMN IF EXISTS referrer_domain,
+DROP COLUMN IF EXISTS device_type,
+DROP COLUMN IF EXISTS os,
+DROP COLUMN IF EXISTS browser;
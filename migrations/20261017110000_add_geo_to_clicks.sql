@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE clicks
+ADD COLUMN country TEXT,
+ADD COLUMN region TEXT,
+ADD COLUMN city TEXT;
+
+-- +goose Down
+ALTER TABLE clicks
+DROP COLUMN IF EXISTS city,
+DROP COLUMN IF EXISTS region,
+DROP COLUMN IF EXISTS country;
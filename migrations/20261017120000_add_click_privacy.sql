@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN ip_mode TEXT CHECK (ip_mode IN ('full', 'truncate', 'hash'));
+
+-- Daily click counts of raw clicks removed by the retention job.
+CREATE TABLE link_click_totals (
+    link_id BIGINT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    clicks BIGINT NOT NULL,
+    PRIMARY KEY (link_id, day)
+);
+
+CREATE INDEX idx_clicks_clicked_at ON clicks(clicked_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_clicks_clicked_at;
+
+DROP TABLE IF EXISTS link_click_totals;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS ip_mode;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- Copies of the per-link, per-day HyperLogLog keys kept in Redis, so unique
+-- visitor counts survive eviction and restarts.
+CREATE TABLE link_visitor_sketches (
+    link_id BIGINT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    sketch BYTEA NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (link_id, day)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS link_visitor_sketches;
@@ -0,0 +1,28 @@
+-- +goose Up
+ALTER TABLE clicks
+ADD COLUMN is_bot BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN bot_name TEXT,
+ADD COLUMN is_preview BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Archived totals keep bots apart so they can still be filtered out.
+ALTER TABLE link_click_totals
+ADD COLUMN bot_clicks BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN preview_clicks BIGINT NOT NULL DEFAULT 0;
+
+-- Best-effort classification of clicks stored before detection existed. New
+-- clicks are classified by the worker. A NULL user agent is left alone: it is
+-- how clicks are stored when privacy.store_user_agent is off.
+UPDATE clicks
+SET is_bot = TRUE
+WHERE user_agent = ''
+    OR user_agent ~* '(bot|crawl|spider|slurp|facebookexternalhit|whatsapp|curl/|wget/|python-|go-http-client|okhttp|headless)';
+
+-- +goose Down
+ALTER TABLE link_click_totals
+DROP COLUMN IF EXISTS preview_clicks,
+DROP COLUMN IF EXISTS bot_clicks;
+
+ALTER TABLE clicks
+DROP COLUMN IF EXISTS is_preview,
+DROP COLUMN IF EXISTS bot_name,
+DROP COLUMN IF EXISTS is_bot;
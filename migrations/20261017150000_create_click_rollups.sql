@@ -0,0 +1,103 @@
+-- +goose Up
+-- Click counts per link, UTC hour or day, and dimension. Missing dimension
+-- values are stored as '' so they can be part of the primary key. The worker
+-- upserts these in the same transaction as the raw clicks.
+CREATE TABLE link_clicks_hourly (
+    link_id BIGINT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+    bucket TIMESTAMPTZ NOT NULL,
+    country TEXT NOT NULL DEFAULT '',
+    device_type TEXT NOT NULL DEFAULT '',
+    referrer_domain TEXT NOT NULL DEFAULT '',
+    is_bot BOOLEAN NOT NULL DEFAULT FALSE,
+    clicks BIGINT NOT NULL DEFAULT 0,
+    previews BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (link_id, bucket, country, device_type, referrer_domain, is_bot)
+);
+
+CREATE TABLE link_clicks_daily (
+    link_id BIGINT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    country TEXT NOT NULL DEFAULT '',
+    device_type TEXT NOT NULL DEFAULT '',
+    referrer_domain TEXT NOT NULL DEFAULT '',
+    is_bot BOOLEAN NOT NULL DEFAULT FALSE,
+    clicks BIGINT NOT NULL DEFAULT 0,
+    previews BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (link_id, day, country, device_type, referrer_domain, is_bot)
+);
+
+INSERT INTO link_clicks_hourly (link_id, bucket, country, device_type, referrer_domain, is_bot, clicks, previews)
+SELECT
+    link_id,
+    date_trunc('hour', clicked_at, 'UTC'),
+    COALESCE(country, ''),
+    COALESCE(device_type, ''),
+    COALESCE(referrer_domain, ''),
+    is_bot,
+    COUNT(*),
+    COUNT(*) FILTER (WHERE is_preview)
+FROM clicks
+GROUP BY 1, 2, 3, 4, 5, 6;
+
+INSERT INTO link_clicks_daily (link_id, day, country, device_type, referrer_domain, is_bot, clicks, previews)
+SELECT
+    link_id,
+    (clicked_at AT TIME ZONE 'UTC')::date,
+    COALESCE(country, ''),
+    COALESCE(device_type, ''),
+    COALESCE(referrer_domain, ''),
+    is_bot,
+    COUNT(*),
+    COUNT(*) FILTER (WHERE is_preview)
+FROM clicks
+GROUP BY 1, 2, 3, 4, 5, 6;
+
+-- Clicks already removed by the retention job only survive as daily totals
+-- without dimensions; they are kept at midnight UTC in the hourly table.
+INSERT INTO link_clicks_daily (link_id, day, is_bot, clicks, previews)
+SELECT link_id, day, FALSE, clicks, 0 FROM link_click_totals WHERE clicks > 0
+UNION ALL
+SELECT link_id, day, TRUE, bot_clicks, preview_clicks FROM link_click_totals WHERE bot_clicks > 0 OR preview_clicks > 0
+ON CONFLICT (link_id, day, country, device_type, referrer_domain, is_bot) DO UPDATE
+    SET clicks = link_clicks_daily.clicks + EXCLUDED.clicks,
+        previews = link_clicks_daily.previews + EXCLUDED.previews;
+
+INSERT INTO link_clicks_hourly (link_id, bucket, is_bot, clicks, previews)
+SELECT link_id, day::timestamp AT TIME ZONE 'UTC', FALSE, clicks, 0 FROM link_click_totals WHERE clicks > 0
+UNION ALL
+SELECT link_id, day::timestamp AT TIME ZONE 'UTC', TRUE, bot_clicks, preview_clicks FROM link_click_totals WHERE bot_clicks > 0 OR preview_clicks > 0
+ON CONFLICT (link_id, bucket, country, device_type, referrer_domain, is_bot) DO UPDATE
+    SET clicks = link_clicks_hourly.clicks + EXCLUDED.clicks,
+        previews = link_clicks_hourly.previews + EXCLUDED.previews;
+
+DROP TABLE link_click_totals;
+
+-- +goose Down
+CREATE TABLE link_click_totals (
+    link_id BIGINT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    clicks BIGINT NOT NULL,
+    bot_clicks BIGINT NOT NULL DEFAULT 0,
+    preview_clicks BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (link_id, day)
+);
+
+-- Only days without raw clicks left are archived totals.
+INSERT INTO link_click_totals (link_id, day, clicks, bot_clicks, preview_clicks)
+SELECT
+    d.link_id,
+    d.day,
+    COALESCE(SUM(d.clicks) FILTER (WHERE NOT d.is_bot), 0),
+    COALESCE(SUM(d.clicks) FILTER (WHERE d.is_bot), 0),
+    SUM(d.previews)
+FROM link_clicks_daily d
+WHERE NOT EXISTS (
+    SELECT 1 FROM clicks c
+    WHERE c.link_id = d.link_id
+        AND c.clicked_at >= d.day::timestamp AT TIME ZONE 'UTC'
+        AND c.clicked_at < (d.day + 1)::timestamp AT TIME ZONE 'UTC'
+)
+GROUP BY d.link_id, d.day;
+
+DROP TABLE IF EXISTS link_clicks_daily;
+DROP TABLE IF EXISTS link_clicks_hourly;
@@ -0,0 +1,27 @@
+-- +goose Up
+-- Exports too large to stream in one request. The worker writes the file to
+-- the shared export directory and records its name; both the job and the file
+-- are removed after expires_at.
+CREATE TABLE export_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    dataset TEXT NOT NULL,
+    format TEXT NOT NULL,
+    link_id BIGINT REFERENCES links(id) ON DELETE CASCADE,
+    from_time TIMESTAMPTZ NOT NULL,
+    to_time TIMESTAMPTZ NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    file_name TEXT,
+    row_count BIGINT NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_export_jobs_user_id ON export_jobs(user_id);
+CREATE INDEX idx_export_jobs_pending ON export_jobs(id) WHERE status IN ('pending', 'running');
+
+-- +goose Down
+DROP TABLE IF EXISTS export_jobs;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- Accounts created before verification existed count as verified.
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+UPDATE users SET email_verified_at = created_at;
+
+-- Single-use tokens for email verification and password reset. The token
+-- itself is signed and carries its expiry; only a SHA-256 hash of its nonce
+-- is stored, to mark it used. A user has at most one token per purpose;
+-- issuing a new one replaces the old row.
+CREATE TABLE user_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL,
+    nonce_hash BYTEA NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    UNIQUE (user_id, purpose)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS user_tokens;
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
@@ -0,0 +1,191 @@
+package geoip
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// reloadDelay lets a database that is being copied into place settle before
+// it is reopened, so a half-written file is not picked up.
+const reloadDelay = time.Second
+
+// Location is the place an IP address resolves to. Fields are empty when the
+// address is private, unknown or no database is loaded.
+type Location struct {
+	// Country is the ISO 3166-1 alpha-2 code, e.g. "DE".
+	Country string
+	// Region is the English name of the first subdivision, e.g. "Bavaria".
+	Region string
+	City   string
+}
+
+// record is the subset of the GeoIP2/GeoLite2 City schema that is decoded.
+// DB-IP and other databases in the same layout work as well.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// Reader resolves IP addresses against a local MaxMind-format (MMDB) file. It
+// never makes network calls. A Reader opened with an empty path is valid and
+// resolves every address to an empty Location.
+type Reader struct {
+	path string
+
+	mu sync.RWMutex
+	db *maxminddb.Reader
+}
+
+// Open loads the database at path. An empty path disables lookups.
+func Open(path string) (*Reader, error) {
+	r := &Reader{path: path}
+	if path == "" {
+		return r, nil
+	}
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open GeoIP database: %w", err)
+	}
+	r.db = db
+	return r, nil
+}
+
+// Enabled reports whether a database is loaded.
+func (r *Reader) Enabled() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.db != nil
+}
+
+// Lookup resolves ip, which may carry a port as in "203.0.113.7:51234" or
+// "[2001:db8::1]:443". Unparseable or unknown addresses return an empty
+// Location.
+func (r *Reader) Lookup(ip string) Location {
+	addr, ok := parseAddr(ip)
+	if !ok {
+		return Location{}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.db == nil {
+		return Location{}
+	}
+
+	var rec record
+	if err := r.db.Lookup(net.IP(addr.AsSlice()), &rec); err != nil {
+		return Location{}
+	}
+	loc := Location{
+		Country: rec.Country.ISOCode,
+		City:    rec.City.Names["en"],
+	}
+	if len(rec.Subdivisions) > 0 {
+		loc.Region = rec.Subdivisions[0].Names["en"]
+	}
+	return loc
+}
+
+func parseAddr(ip string) (netip.Addr, bool) {
+	if addrPort, err := netip.ParseAddrPort(ip); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// Watch reopens the database whenever the file is written or replaced until
+// ctx is cancelled. If the new file cannot be opened, the previous database
+// stays in use. The parent directory is watched so that updates which rename
+// a new file over the old one are seen as well.
+func (r *Reader) Watch(ctx context.Context) error {
+	if r.path == "" {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(filepath.Dir(r.path)); err != nil {
+		return err
+	}
+	name := filepath.Clean(r.path)
+
+	var reload <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) == name && (event.Has(fsnotify.Write) || event.Has(fsnotify.Create)) {
+				reload = time.After(reloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("GeoIP database watcher error: %v", err)
+		case <-reload:
+			reload = nil
+			if err := r.reload(); err != nil {
+				log.Printf("Keeping previous GeoIP database: %v", err)
+				continue
+			}
+			log.Printf("Reloaded GeoIP database from %s", r.path)
+		}
+	}
+}
+
+func (r *Reader) reload() error {
+	db, err := maxminddb.Open(r.path)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	old := r.db
+	r.db = db
+	r.mu.Unlock()
+
+	if old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+// Close releases the database.
+func (r *Reader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.db == nil {
+		return nil
+	}
+	err := r.db.Close()
+	r.db = nil
+	return err
+}
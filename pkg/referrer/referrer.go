@@ -0,0 +1,87 @@
+package referrer
+
+import (
+	"net/url"
+	"strings"
+)
+
+// aliases folds the many hosts a source uses (link shorteners, mobile and
+// link-shim subdomains) into a single canonical domain.
+var aliases = map[string]string{
+	"t.co":                  "twitter.com",
+	"x.com":                 "twitter.com",
+	"mobile.twitter.com":    "twitter.com",
+	"fb.com":                "facebook.com",
+	"fb.me":                 "facebook.com",
+	"l.facebook.com":        "facebook.com",
+	"lm.facebook.com":       "facebook.com",
+	"m.facebook.com":        "facebook.com",
+	"l.instagram.com":       "instagram.com",
+	"lnkd.in":               "linkedin.com",
+	"old.reddit.com":        "reddit.com",
+	"out.reddit.com":        "reddit.com",
+	"np.reddit.com":         "reddit.com",
+	"youtu.be":              "youtube.com",
+	"m.youtube.com":         "youtube.com",
+	"news.ycombinator.com":  "news.ycombinator.com",
+	"t.me":                  "telegram.org",
+	"web.telegram.org":      "telegram.org",
+	"web.whatsapp.com":      "whatsapp.com",
+	"wa.me":                 "whatsapp.com",
+	"com.slack":             "slack.com",
+	"app.slack.com":         "slack.com",
+	"mail.google.com":       "mail.google.com",
+	"com.google.android.gm": "mail.google.com",
+	"out.pinterest.com":     "pinterest.com",
+	"pin.it":                "pinterest.com",
+}
+
+// Domain normalises a Referer header to the domain of the source, e.g.
+// "https://t.co/abc" becomes "twitter.com" and "https://www.google.co.uk/"
+// becomes "google.com". An empty or unparseable referrer returns "".
+func Domain(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return ""
+	}
+	host = strings.TrimSuffix(host, ".")
+	host = strings.TrimPrefix(host, "www.")
+
+	if canonical, ok := aliases[host]; ok {
+		return canonical
+	}
+	if isGoogle(host) {
+		return "google.com"
+	}
+	for _, prefix := range []string{"m.", "mobile.", "amp."} {
+		if trimmed, ok := strings.CutPrefix(host, prefix); ok && strings.Contains(trimmed, ".") {
+			host = trimmed
+			break
+		}
+	}
+	if canonical, ok := aliases[host]; ok {
+		return canonical
+	}
+	return host
+}
+
+// isGoogle matches Google search on its regional domains such as google.de,
+// google.co.uk and google.com.au.
+func isGoogle(host string) bool {
+	host = strings.TrimPrefix(host, "m.")
+	rest, ok := strings.CutPrefix(host, "google.")
+	if !ok {
+		return false
+	}
+	parts := strings.Split(rest, ".")
+	return len(parts) <= 2 && len(parts[len(parts)-1]) >= 2
+}
@@ -0,0 +1,47 @@
+package referrer
+
+import "testing"
+
+func TestDomain(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"empty", "", ""},
+		{"blank", "   ", ""},
+		{"unparseable", "http://[::1", ""},
+		{"no host", "/relative/path", ""},
+		{"plain host", "https://example.com/page", "example.com"},
+		{"www prefix", "https://www.example.com/", "example.com"},
+		{"upper case and trailing dot", "https://WWW.Example.COM./", "example.com"},
+		{"port", "http://example.com:8080/", "example.com"},
+		{"twitter shortener", "https://t.co/abc123", "twitter.com"},
+		{"x.com", "https://x.com/someone/status/1", "twitter.com"},
+		{"facebook link shim", "https://l.facebook.com/l.php?u=https%3A%2F%2Fexample.com", "facebook.com"},
+		{"facebook mobile shim", "https://lm.facebook.com/", "facebook.com"},
+		{"linkedin shortener", "https://lnkd.in/xyz", "linkedin.com"},
+		{"old reddit", "https://old.reddit.com/r/golang/", "reddit.com"},
+		{"youtube short link", "https://youtu.be/dQw4w9WgXcQ", "youtube.com"},
+		{"hacker news", "https://news.ycombinator.com/item?id=1", "news.ycombinator.com"},
+		{"android app referrer", "android-app://com.slack/", "slack.com"},
+		{"gmail app", "android-app://com.google.android.gm/", "mail.google.com"},
+		{"google", "https://www.google.com/", "google.com"},
+		{"google country domain", "https://www.google.co.uk/", "google.com"},
+		{"google two-part tld", "https://www.google.com.au/", "google.com"},
+		{"google mobile", "https://m.google.de/", "google.com"},
+		{"google subdomain is not search", "https://docs.google.com/document/d/1", "docs.google.com"},
+		{"mobile prefix", "https://m.example.com/", "example.com"},
+		{"amp prefix", "https://amp.example.com/story", "example.com"},
+		{"mobile prefix then alias", "https://mobile.twitter.com/", "twitter.com"},
+		{"mobile prefix on a bare tld", "https://m.io/", "m.io"},
+		{"ip address", "http://192.0.2.1/", "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Domain(tt.raw); got != tt.want {
+				t.Errorf("Domain(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package useragent
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	emptyUserAgentBot = "Empty user agent"
+	otherBot          = "Other bot"
+)
+
+// bot maps a User-Agent substring to a bot name. Matching is case-insensitive.
+// When the substring also appears in browsers, such as the in-app browsers of
+// chat apps, confirm must match the lowercased User-Agent as well.
+type bot struct {
+	match   string
+	name    string
+	preview bool
+	confirm *regexp.Regexp
+}
+
+// knownBots is checked in order. Some unfurlers send several tokens (iMessage
+// sends "facebookexternalhit Facebot Twitterbot", Telegram "TelegramBot (like
+// TwitterBot)"), so the first match wins.
+var knownBots = []bot{
+	// Link previews in chat and social apps.
+	{"slackbot", "Slackbot", true, nil},
+	{"slack-imgproxy", "Slackbot", true, nil},
+	{"facebookexternalhit", "Facebook", true, nil},
+	{"facebot", "Facebook", true, nil},
+	{"telegrambot", "TelegramBot", true, nil},
+	{"twitterbot", "Twitterbot", true, nil},
+	{"linkedinbot", "LinkedInBot", true, nil},
+	{"discordbot", "Discordbot", true, nil},
+	{"whatsapp", "WhatsApp", true, nil},
+	{"skypeuripreview", "Skype", true, nil},
+	{"microsoftpreview", "Microsoft Teams", true, nil},
+	{"redditbot", "Redditbot", true, nil},
+	{"pinterestbot", "Pinterestbot", true, nil},
+	{"mastodon", "Mastodon", true, nil},
+	{"vkshare", "VK", true, nil},
+	{"embedly", "Embedly", true, nil},
+	{"iframely", "Iframely", true, nil},
+	{"google-pagerenderer", "Google Page Renderer", true, nil},
+	{"bitlybot", "Bitly", true, nil},
+	{"viber", "Viber", true, regexp.MustCompile(`viber.*(bot|preview)`)},
+	{"snap url preview", "Snapchat", true, nil},
+	{"snapchatads", "Snapchat", true, nil},
+	{"snapchat", "Snapchat", true, regexp.MustCompile(`snapchat.*bot`)},
+	// Search engines and crawlers.
+	{"googlebot", "Googlebot", false, nil},
+	{"adsbot-google", "Googlebot", false, nil},
+	{"google-inspectiontool", "Googlebot", false, nil},
+	{"bingbot", "Bingbot", false, nil},
+	{"bingpreview", "Bingbot", false, nil},
+	{"yandexbot", "YandexBot", false, nil},
+	{"duckduckbot", "DuckDuckBot", false, nil},
+	{"baiduspider", "Baiduspider", false, nil},
+	{"applebot", "Applebot", false, nil},
+	{"ahrefsbot", "AhrefsBot", false, nil},
+	{"semrushbot", "SemrushBot", false, nil},
+	{"mj12bot", "MJ12bot", false, nil},
+	{"dotbot", "DotBot", false, nil},
+	{"petalbot", "PetalBot", false, nil},
+	{"bytespider", "Bytespider", false, nil},
+	{"gptbot", "GPTBot", false, nil},
+	{"chatgpt-user", "ChatGPT", false, nil},
+	{"claudebot", "ClaudeBot", false, nil},
+	{"ccbot", "CCBot", false, nil},
+	{"archive.org_bot", "Internet Archive", false, nil},
+	// Uptime monitors.
+	{"uptimerobot", "UptimeRobot", false, nil},
+	{"pingdom", "Pingdom", false, nil},
+	{"statuscake", "StatusCake", false, nil},
+	{"site24x7", "Site24x7", false, nil},
+	{"betteruptime", "Better Uptime", false, nil},
+	{"better uptime", "Better Uptime", false, nil},
+	{"datadogsynthetics", "Datadog Synthetics", false, nil},
+	{"newrelicpinger", "New Relic", false, nil},
+	{"checkly", "Checkly", false, nil},
+	// Scripts, HTTP libraries and headless browsers.
+	{"headlesschrome", "Headless Chrome", false, nil},
+	{"phantomjs", "PhantomJS", false, nil},
+	{"curl/", "curl", false, nil},
+	{"wget/", "Wget", false, nil},
+	{"python-requests", "Python", false, nil},
+	{"python-urllib", "Python", false, nil},
+	{"aiohttp", "Python", false, nil},
+	{"httpx", "Python", false, nil},
+	{"scrapy", "Scrapy", false, nil},
+	{"go-http-client", "Go", false, nil},
+	{"okhttp", "OkHttp", false, nil},
+	{"axios/", "Node.js", false, nil},
+	{"node-fetch", "Node.js", false, nil},
+	{"undici", "Node.js", false, nil},
+	{"java/", "Java", false, nil},
+	{"apache-httpclient", "Java", false, nil},
+	{"libwww-perl", "Perl", false, nil},
+	{"ruby", "Ruby", false, regexp.MustCompile(`^ruby(/|\s|$)`)},
+	{"postmanruntime", "Postman", false, nil},
+	{"insomnia", "Insomnia", false, nil},
+}
+
+// botMarkers are generic words that only automated clients put in their
+// User-Agent.
+var botMarkers = []string{"bot", "crawler", "spider", "crawl", "slurp", "fetcher", "scraper", "monitor", "preview", "headless"}
+
+// detectBot checks the known bot list, then falls back to heuristics: generic
+// bot words, a contact URL (crawlers advertise "+http://..."), or a string
+// that does not look like any browser.
+func detectBot(ua string) (name string, preview bool, ok bool) {
+	lower := strings.ToLower(ua)
+	for _, b := range knownBots {
+		if strings.Contains(lower, b.match) && (b.confirm == nil || b.confirm.MatchString(lower)) {
+			return b.name, b.preview, true
+		}
+	}
+	for _, marker := range botMarkers {
+		if strings.Contains(lower, marker) {
+			return otherBot, false, true
+		}
+	}
+	if strings.Contains(lower, "+http") || strings.Contains(lower, "@") {
+		return otherBot, false, true
+	}
+	// Every mainstream browser and in-app webview starts with Mozilla/.
+	if !strings.HasPrefix(ua, "Mozilla/") && !strings.HasPrefix(ua, "Opera/") {
+		return otherBot, false, true
+	}
+	return "", false, false
+}
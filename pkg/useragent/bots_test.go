@@ -0,0 +1,151 @@
+package useragent
+
+import "testing"
+
+// botSamples holds a real-world User-Agent for every entry of knownBots, keyed
+// by the entry's match string.
+var botSamples = map[string]string{
+	"slackbot":              "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+	"slack-imgproxy":        "Slack-ImgProxy (+https://api.slack.com/robots)",
+	"facebookexternalhit":   "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)",
+	"facebot":               "Facebot",
+	"telegrambot":           "TelegramBot (like TwitterBot)",
+	"twitterbot":            "Twitterbot/1.0",
+	"linkedinbot":           "LinkedInBot/1.0 (compatible; Mozilla/5.0; Apache-HttpClient +http://www.linkedin.com)",
+	"discordbot":            "Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)",
+	"whatsapp":              "WhatsApp/2.23.20.0 A",
+	"skypeuripreview":       "Mozilla/5.0 (Windows NT 6.1; WOW64) SkypeUriPreview Preview/0.5",
+	"microsoftpreview":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/112.0.0.0 Safari/537.36 Edg/112.0.1722.48 MicrosoftPreview/2.0 +https://aka.ms/MicrosoftPreview",
+	"redditbot":             "Mozilla/5.0 (compatible; redditbot/1.0; +http://www.reddit.com/feedback)",
+	"pinterestbot":          "Mozilla/5.0 (compatible; Pinterestbot/1.0; +http://www.pinterest.com/bot.html)",
+	"mastodon":              "http.rb/5.1.1 (Mastodon/4.2.1; +https://mastodon.social/)",
+	"vkshare":               "Mozilla/5.0 (compatible; vkShare; +http://vk.com/dev/Share)",
+	"embedly":               "Mozilla/5.0 (compatible; Embedly/0.2; +http://support.embed.ly/)",
+	"iframely":              "Iframely/1.3.1 (+https://iframely.com/docs/about)",
+	"google-pagerenderer":   "Mozilla/5.0 (Windows NT 6.1; rv:6.0) Gecko/20110814 Firefox/6.0 Google (+https://developers.google.com/+/web/snippet/) Google-PageRenderer",
+	"bitlybot":              "bitlybot/3.0 (+http://bit.ly/)",
+	"viber":                 "Mozilla/5.0 (compatible; ViberBot/1.0; +https://www.viber.com)",
+	"snap url preview":      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/83.0.4103.116 Safari/537.36 (compatible; Snap URL Preview Service; bot; snapchat; https://developers.snap.com/robots)",
+	"snapchatads":           "Mozilla/5.0 (compatible; SnapchatAds/1.0)",
+	"snapchat":              "Mozilla/5.0 (compatible; Snapchat Bot/1.0)",
+	"googlebot":             "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+	"adsbot-google":         "AdsBot-Google (+http://www.google.com/adsbot.html)",
+	"google-inspectiontool": "Mozilla/5.0 (compatible; Google-InspectionTool/1.0;)",
+	"bingbot":               "Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)",
+	"bingpreview":           "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/79.0.3945.74 Safari/537.36 BingPreview/1.0b",
+	"yandexbot":             "Mozilla/5.0 (compatible; YandexBot/3.0; +http://yandex.com/bots)",
+	"duckduckbot":           "DuckDuckBot/1.1; (+http://duckduckgo.com/duckduckbot.html)",
+	"baiduspider":           "Mozilla/5.0 (compatible; Baiduspider/2.0; +http://www.baidu.com/search/spider.html)",
+	"applebot":              "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.1.1 Safari/605.1.15 (Applebot/0.1; +http://www.apple.com/go/applebot)",
+	"ahrefsbot":             "Mozilla/5.0 (compatible; AhrefsBot/7.0; +http://ahrefs.com/robot/)",
+	"semrushbot":            "Mozilla/5.0 (compatible; SemrushBot/7~bl; +http://www.semrush.com/bot.html)",
+	"mj12bot":               "Mozilla/5.0 (compatible; MJ12bot/v1.4.8; http://mj12bot.com/)",
+	"dotbot":                "Mozilla/5.0 (compatible; DotBot/1.2; +https://opensiteexplorer.org/dotbot; help@moz.com)",
+	"petalbot":              "Mozilla/5.0 (Linux; Android 7.0;) AppleWebKit/537.36 (KHTML, like Gecko) Mobile Safari/537.36 (compatible; PetalBot;+https://webmaster.petalsearch.com/site/petalbot)",
+	"bytespider":            "Mozilla/5.0 (Linux; Android 5.0) AppleWebKit/537.36 (KHTML, like Gecko) Mobile Safari/537.36 (compatible; Bytespider; spider-feedback@bytedance.com)",
+	"gptbot":                "Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; GPTBot/1.0; +https://openai.com/gptbot)",
+	"chatgpt-user":          "Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko); compatible; ChatGPT-User/1.0; +https://openai.com/bot",
+	"claudebot":             "Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; ClaudeBot/1.0; +claudebot@anthropic.com)",
+	"ccbot":                 "CCBot/2.0 (https://commoncrawl.org/faq/)",
+	"archive.org_bot":       "Mozilla/5.0 (compatible; archive.org_bot +http://archive.org/details/archive.org_bot)",
+	"uptimerobot":           "Mozilla/5.0+(compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)",
+	"pingdom":               "Pingdom.com_bot_version_1.4_(http://www.pingdom.com/)",
+	"statuscake":            "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36 StatusCake",
+	"site24x7":              "Site24x7",
+	"betteruptime":          "Mozilla/5.0 (compatible; BetterUptime/1.0)",
+	"better uptime":         "Better Uptime Bot Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/102.0.0.0 Safari/537.36",
+	"datadogsynthetics":     "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36 DatadogSynthetics",
+	"newrelicpinger":        "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/104.0.0.0 Safari/537.36 NewRelicPinger/1.0 (269919)",
+	"checkly":               "Checkly/1.0 (https://www.checklyhq.com)",
+	"headlesschrome":        "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36",
+	"phantomjs":             "Mozilla/5.0 (Unknown; Linux x86_64) AppleWebKit/538.1 (KHTML, like Gecko) PhantomJS/2.1.1 Safari/538.1",
+	"curl/":                 "curl/8.4.0",
+	"wget/":                 "Wget/1.21.4",
+	"python-requests":       "python-requests/2.31.0",
+	"python-urllib":         "Python-urllib/3.11",
+	"aiohttp":               "Python/3.11 aiohttp/3.9.1",
+	"httpx":                 "python-httpx/0.25.2",
+	"scrapy":                "Scrapy/2.11.0 (+https://scrapy.org)",
+	"go-http-client":        "Go-http-client/1.1",
+	"okhttp":                "okhttp/4.12.0",
+	"axios/":                "axios/1.6.2",
+	"node-fetch":            "node-fetch/1.0 (+https://github.com/bitinn/node-fetch)",
+	"undici":                "undici",
+	"java/":                 "Java/17.0.9",
+	"apache-httpclient":     "Apache-HttpClient/4.5.14",
+	"libwww-perl":           "libwww-perl/6.72",
+	"ruby":                  "Ruby",
+	"postmanruntime":        "PostmanRuntime/7.36.0",
+	"insomnia":              "insomnia/8.4.5",
+}
+
+func TestKnownBots(t *testing.T) {
+	for _, b := range knownBots {
+		ua, ok := botSamples[b.match]
+		if !ok {
+			t.Errorf("no sample User-Agent for %q", b.match)
+			continue
+		}
+		name, preview, ok := detectBot(ua)
+		if !ok || name != b.name || preview != b.preview {
+			t.Errorf("detectBot(%q) = %q, %v, %v; want %q, %v, true", ua, name, preview, ok, b.name, b.preview)
+		}
+	}
+}
+
+func TestDetectBotHeuristics(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+	}{
+		{"generic bot word", "Mozilla/5.0 (compatible; ExampleBot/1.0)"},
+		{"contact URL", "Mozilla/5.0 (compatible; Example/1.0; +https://example.com/about)"},
+		{"contact email", "Mozilla/5.0 (compatible; Example/1.0; ops@example.com)"},
+		{"not a browser", "SomeTool/2.0"},
+		{"Ruby HTTP client with version", "Ruby/3.2.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, ok := detectBot(tt.ua); !ok {
+				t.Errorf("detectBot(%q) did not report a bot", tt.ua)
+			}
+		})
+	}
+}
+
+// TestDetectBotHumans covers browsers whose User-Agent contains a token of
+// the bot list, such as the in-app browsers of chat apps.
+func TestDetectBotHumans(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+	}{
+		{"Chrome", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"},
+		{"Safari on iPhone", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1"},
+		{"Firefox", "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"},
+		{"Snapchat in-app browser", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 Snapchat/12.58.0.37 (like Safari/8616.2.9.0.10, panda)"},
+		{"Viber in-app browser", "Mozilla/5.0 (Linux; Android 13; SM-A536B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.6045.163 Mobile Safari/537.36 Viber/21.0.2.0"},
+		{"browser mentioning Ruby", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 RubyMine/2023.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name, _, ok := detectBot(tt.ua); ok {
+				t.Errorf("detectBot(%q) = %q, want no bot", tt.ua, name)
+			}
+		})
+	}
+}
+
+// A stored User-Agent is empty when the deployment does not keep it, so only
+// a missing request header counts as a bot.
+func TestEmptyUserAgent(t *testing.T) {
+	if info := Parse(""); info.Bot {
+		t.Errorf("Parse(\"\") = %+v, want no bot", info)
+	}
+	if info := ParseHeader(""); !info.Bot || info.BotName != emptyUserAgentBot {
+		t.Errorf("ParseHeader(\"\") = %+v, want bot %q", info, emptyUserAgentBot)
+	}
+	if info := ParseHeader("curl/8.4.0"); !info.Bot || info.BotName != "curl" {
+		t.Errorf("ParseHeader(\"curl/8.4.0\") = %+v, want bot \"curl\"", info)
+	}
+}
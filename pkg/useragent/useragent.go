@@ -0,0 +1,137 @@
+package useragent
+
+import "strings"
+
+// Device classes reported by Parse.
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// Info is the browser, operating system and device class of a User-Agent.
+type Info struct {
+	Browser string
+	OS      string
+	Device  string
+	// Bot is set for crawlers, link unfurlers, uptime monitors and HTTP
+	// libraries. BotName names the bot, or is "Other bot" when it was only
+	// recognised by heuristics.
+	Bot     bool
+	BotName string
+	// Preview is set for bots that fetch a link to render a preview of it in
+	// a chat or social app.
+	Preview bool
+}
+
+// token maps a User-Agent substring to the name reported for it.
+type token struct {
+	match string
+	name  string
+}
+
+// browsers is checked in order: most browsers also claim to be Chrome, Safari
+// or Mozilla, so the more specific tokens must come first.
+var browsers = []token{
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"Edge/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Opera", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"YaBrowser/", "Yandex Browser"},
+	{"UCBrowser/", "UC Browser"},
+	{"Vivaldi/", "Vivaldi"},
+	{"DuckDuckGo/", "DuckDuckGo"},
+	{"FxiOS/", "Firefox"},
+	{"Firefox/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chromium/", "Chromium"},
+	{"Chrome/", "Chrome"},
+	{"MSIE ", "Internet Explorer"},
+	{"Trident/", "Internet Explorer"},
+	{"Version/", "Safari"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+	{"Wget/", "Wget"},
+	{"python-requests/", "Python Requests"},
+	{"Go-http-client/", "Go HTTP Client"},
+}
+
+var operatingSystems = []token{
+	{"Windows Phone", "Windows Phone"},
+	{"Windows", "Windows"},
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"iPod", "iOS"},
+	{"Android", "Android"},
+	{"CrOS", "Chrome OS"},
+	{"Mac OS X", "macOS"},
+	{"Macintosh", "macOS"},
+	{"Ubuntu", "Linux"},
+	{"Linux", "Linux"},
+	{"FreeBSD", "FreeBSD"},
+}
+
+// Parse classifies a User-Agent string with plain substring checks. It is
+// meant to run once per click at ingestion, not at query time. Values that
+// cannot be recognised are reported as "Other", and an empty User-Agent as
+// "Unknown". An empty User-Agent is not taken for a bot: stored ones are
+// empty whenever the deployment does not keep them.
+func Parse(ua string) Info {
+	if strings.TrimSpace(ua) == "" {
+		return Info{Browser: "Unknown", OS: "Unknown", Device: DeviceUnknown}
+	}
+
+	info := Info{
+		Browser: lookup(browsers, ua),
+		OS:      lookup(operatingSystems, ua),
+		Device:  device(ua),
+	}
+	if name, preview, ok := detectBot(ua); ok {
+		info.Bot = true
+		info.BotName = name
+		info.Preview = preview
+		info.Device = DeviceBot
+	}
+	return info
+}
+
+// ParseHeader is Parse for the User-Agent header of a request as it was
+// received. Browsers always send one, so a missing header marks a script.
+func ParseHeader(ua string) Info {
+	if strings.TrimSpace(ua) == "" {
+		return Info{Browser: "Unknown", OS: "Unknown", Device: DeviceUnknown, Bot: true, BotName: emptyUserAgentBot}
+	}
+	return Parse(ua)
+}
+
+func lookup(tokens []token, ua string) string {
+	for _, t := range tokens {
+		if strings.Contains(ua, t.match) {
+			return t.name
+		}
+	}
+	return "Other"
+}
+
+func device(ua string) string {
+	switch {
+	case strings.Contains(ua, "iPad"),
+		strings.Contains(ua, "Tablet"),
+		strings.Contains(ua, "Kindle"),
+		strings.Contains(ua, "Silk/"),
+		strings.Contains(ua, "Android") && !strings.Contains(ua, "Mobile"):
+		return DeviceTablet
+	case strings.Contains(ua, "Mobi"),
+		strings.Contains(ua, "iPhone"),
+		strings.Contains(ua, "iPod"),
+		strings.Contains(ua, "Windows Phone"):
+		return DeviceMobile
+	default:
+		return DeviceDesktop
+	}
+}
@@ -0,0 +1,119 @@
+package useragent
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want Info
+	}{
+		{
+			"empty",
+			"",
+			Info{Browser: "Unknown", OS: "Unknown", Device: DeviceUnknown},
+		},
+		{
+			"Chrome on Windows",
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			Info{Browser: "Chrome", OS: "Windows", Device: DeviceDesktop},
+		},
+		{
+			"Edge on Windows",
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			Info{Browser: "Edge", OS: "Windows", Device: DeviceDesktop},
+		},
+		{
+			"Opera on macOS",
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36 OPR/105.0.0.0",
+			Info{Browser: "Opera", OS: "macOS", Device: DeviceDesktop},
+		},
+		{
+			"Safari on macOS",
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15",
+			Info{Browser: "Safari", OS: "macOS", Device: DeviceDesktop},
+		},
+		{
+			"Firefox on Linux",
+			"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			Info{Browser: "Firefox", OS: "Linux", Device: DeviceDesktop},
+		},
+		{
+			"Chrome on Chrome OS",
+			"Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			Info{Browser: "Chrome", OS: "Chrome OS", Device: DeviceDesktop},
+		},
+		{
+			"Safari on iPhone",
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+			Info{Browser: "Safari", OS: "iOS", Device: DeviceMobile},
+		},
+		{
+			"Chrome on iPhone",
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1",
+			Info{Browser: "Chrome", OS: "iOS", Device: DeviceMobile},
+		},
+		{
+			"Firefox on iPhone",
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) FxiOS/121.0 Mobile/15E148 Safari/605.1.15",
+			Info{Browser: "Firefox", OS: "iOS", Device: DeviceMobile},
+		},
+		{
+			"Safari on iPad",
+			"Mozilla/5.0 (iPad; CPU OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+			Info{Browser: "Safari", OS: "iPadOS", Device: DeviceTablet},
+		},
+		{
+			"Chrome on Android phone",
+			"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.144 Mobile Safari/537.36",
+			Info{Browser: "Chrome", OS: "Android", Device: DeviceMobile},
+		},
+		{
+			"Samsung Internet on Android tablet",
+			"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Safari/537.36",
+			Info{Browser: "Samsung Internet", OS: "Android", Device: DeviceTablet},
+		},
+		{
+			"Kindle tablet",
+			"Mozilla/5.0 (Linux; Android 9; KFTRWI) AppleWebKit/537.36 (KHTML, like Gecko) Silk/119.3.1 like Chrome/119.0.6045.193 Safari/537.36",
+			Info{Browser: "Chrome", OS: "Android", Device: DeviceTablet},
+		},
+		{
+			"Internet Explorer 11",
+			"Mozilla/5.0 (Windows NT 10.0; WOW64; Trident/7.0; rv:11.0) like Gecko",
+			Info{Browser: "Internet Explorer", OS: "Windows", Device: DeviceDesktop},
+		},
+		{
+			"Windows Phone",
+			"Mozilla/5.0 (Windows Phone 10.0; Android 6.0.1; Microsoft; Lumia 950) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/52.0.2743.116 Mobile Safari/537.36 Edge/15.15063",
+			Info{Browser: "Edge", OS: "Windows Phone", Device: DeviceMobile},
+		},
+		{
+			"unknown browser",
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko)",
+			Info{Browser: "Other", OS: "macOS", Device: DeviceDesktop},
+		},
+		{
+			"crawler",
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			Info{Browser: "Other", OS: "Other", Device: DeviceBot, Bot: true, BotName: "Googlebot"},
+		},
+		{
+			"link preview",
+			"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+			Info{Browser: "Other", OS: "Other", Device: DeviceBot, Bot: true, BotName: "Slackbot", Preview: true},
+		},
+		{
+			"HTTP library",
+			"curl/8.4.0",
+			Info{Browser: "curl", OS: "Other", Device: DeviceBot, Bot: true, BotName: "curl"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.ua); got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.ua, got, tt.want)
+			}
+		})
+	}
+}